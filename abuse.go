@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxGuessesPerMinute  = 60
+	defaultMaxNotFoundPerMinute = 120
+	defaultBlockDuration        = 15 * time.Minute
+	defaultChallengeDifficulty  = 16
+)
+
+// AbuseConfig controls when clients are automatically blocked.
+type AbuseConfig struct {
+	// MaxGuessesPerMinute is how many guesses a client can make in a minute
+	// before being blocked.
+	MaxGuessesPerMinute int `yaml:"max_guesses_per_minute"`
+	// MaxNotFoundPerMinute is how many requests for puzzles, files or parts
+	// that don't exist (or aren't unlocked) a client can make in a minute
+	// before being blocked. Lots of these usually means someone is scraping.
+	MaxNotFoundPerMinute int `yaml:"max_not_found_per_minute"`
+	// BlockDuration is how long automatic blocks last.
+	BlockDuration time.Duration `yaml:"block_duration"`
+	// ChallengeGuessesPerMinute is how many guesses a client can make in a
+	// minute before each further one needs a proof-of-work challenge solving
+	// first. This slows scripts down a lot more than people. Zero turns
+	// challenges off.
+	ChallengeGuessesPerMinute int `yaml:"challenge_guesses_per_minute"`
+	// ChallengeDifficulty is how many leading zero bits the hash solving a
+	// challenge needs. Each extra bit doubles the work.
+	ChallengeDifficulty int `yaml:"challenge_difficulty"`
+}
+
+// abuseGuard rejects requests from blocked clients, and blocks clients
+// that behave pathologically for a while.
+type abuseGuard struct {
+	config *Config
+	mutex  sync.Mutex
+	// blocked are the addresses and ranges blocked in the config or from the
+	// admin page, which stay blocked until they're unblocked.
+	blocked []*net.IPNet
+	clients map[string]*clientActivity
+	// usedChallenges are the solved challenges that haven't expired yet, and
+	// when they expire, so each can only be used once.
+	usedChallenges map[string]time.Time
+}
+
+// AutomaticBlock is a client that's been blocked for a while for making too
+// many requests.
+type AutomaticBlock struct {
+	IP    string
+	Until time.Time
+}
+
+type clientActivity struct {
+	windowStart  time.Time
+	guesses      int
+	notFound     int
+	blockedUntil time.Time
+}
+
+func newAbuseGuard(config *Config) *abuseGuard {
+	guard := &abuseGuard{
+		config:         config,
+		clients:        make(map[string]*clientActivity),
+		usedChallenges: make(map[string]time.Time),
+	}
+	for _, entry := range config.BlockedIPs {
+		if err := guard.Block(entry); err != nil {
+			log.Printf("WARNING: ignoring blocked IP: %v", err)
+		}
+	}
+	return guard
+}
+
+// parseNetwork parses an address or CIDR range.
+func parseNetwork(entry string) (*net.IPNet, error) {
+	cidr := strings.TrimSpace(entry)
+	if !strings.Contains(cidr, "/") {
+		if strings.Contains(cidr, ":") {
+			cidr += "/128"
+		} else {
+			cidr += "/32"
+		}
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address or range %q", entry)
+	}
+	return network, nil
+}
+
+// Block refuses all requests from an address or range until it's unblocked.
+func (g *abuseGuard) Block(entry string) error {
+	network, err := parseNetwork(entry)
+	if err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !slices.ContainsFunc(g.blocked, func(blocked *net.IPNet) bool { return blocked.String() == network.String() }) {
+		g.blocked = append(g.blocked, network)
+	}
+	return nil
+}
+
+// Unblock lifts a block on an address or range, whether it was added by
+// Block or automatically.
+func (g *abuseGuard) Unblock(entry string) error {
+	network, err := parseNetwork(entry)
+	if err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.blocked = slices.DeleteFunc(g.blocked, func(blocked *net.IPNet) bool {
+		return blocked.String() == network.String()
+	})
+	for ip, activity := range g.clients {
+		if parsed := net.ParseIP(ip); parsed != nil && network.Contains(parsed) {
+			activity.blockedUntil = time.Time{}
+			activity.windowStart = time.Now()
+		}
+	}
+	return nil
+}
+
+// Blocks returns the blocked addresses and ranges, and the clients blocked
+// automatically that are still blocked.
+func (g *abuseGuard) Blocks() ([]string, []AutomaticBlock) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var blocked []string
+	for _, network := range g.blocked {
+		blocked = append(blocked, network.String())
+	}
+	var automatic []AutomaticBlock
+	for ip, activity := range g.clients {
+		if time.Now().Before(activity.blockedUntil) {
+			automatic = append(automatic, AutomaticBlock{IP: ip, Until: activity.blockedUntil})
+		}
+	}
+	slices.SortFunc(automatic, func(a, b AutomaticBlock) int { return strings.Compare(a.IP, b.IP) })
+	return blocked, automatic
+}
+
+// clientIP returns the address of the client making the request, using the
+// configured header if the server is behind a proxy.
+func (g *abuseGuard) clientIP(request *http.Request) string {
+	if g.config.RealIPHeader != "" {
+		if header := request.Header.Get(g.config.RealIPHeader); header != "" {
+			// Proxies append the address they saw to the end
+			addresses := strings.Split(header, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+func (g *abuseGuard) isBlocked(ip string) bool {
+	parsed := net.ParseIP(ip)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, network := range g.blocked {
+		if parsed != nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	activity, ok := g.clients[ip]
+	return ok && time.Now().Before(activity.blockedUntil)
+}
+
+// activity returns the activity for the client in the current window. The
+// mutex must be held.
+func (g *abuseGuard) activity(ip string) *clientActivity {
+	activity, ok := g.clients[ip]
+	if !ok {
+		activity = &clientActivity{}
+		g.clients[ip] = activity
+	}
+	if time.Since(activity.windowStart) > time.Minute {
+		activity.windowStart = time.Now()
+		activity.guesses = 0
+		activity.notFound = 0
+	}
+	return activity
+}
+
+// record counts a request against the client, blocking them if they've gone
+// over the limits.
+func (g *abuseGuard) record(ip string, guess bool, notFound bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	activity := g.activity(ip)
+	if guess {
+		activity.guesses++
+	}
+	if notFound {
+		activity.notFound++
+	}
+	limits := g.config.Abuse
+	if activity.guesses > limits.MaxGuessesPerMinute {
+		g.block(ip, activity, "too many guesses")
+	} else if activity.notFound > limits.MaxNotFoundPerMinute {
+		g.block(ip, activity, "too many requests for missing or locked puzzles")
+	}
+}
+
+func (g *abuseGuard) block(ip string, activity *clientActivity, reason string) {
+	if time.Now().Before(activity.blockedUntil) {
+		return
+	}
+	activity.blockedUntil = time.Now().Add(g.config.Abuse.BlockDuration)
+	// Start counting afresh once the block is over
+	activity.windowStart = activity.blockedUntil
+	activity.guesses = 0
+	activity.notFound = 0
+	log.Printf("Blocking %s for %s: %s", ip, g.config.Abuse.BlockDuration, reason)
+}
+
+// prune forgets about clients that haven't done anything recently, and
+// challenges that have expired.
+func (g *abuseGuard) prune() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for ip, activity := range g.clients {
+		if time.Since(activity.windowStart) > time.Minute && time.Now().After(activity.blockedUntil) {
+			delete(g.clients, ip)
+		}
+	}
+	for challenge, expiry := range g.usedChallenges {
+		if time.Now().After(expiry) {
+			delete(g.usedChallenges, challenge)
+		}
+	}
+}
+
+func (g *abuseGuard) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ip := g.clientIP(request)
+		if g.isBlocked(ip) {
+			log.Printf("Rejected request from blocked client %s: %s %s", ip, request.Method, request.URL.Path)
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if request.URL.Path == "/guess" && request.Method == http.MethodPost {
+			if challenge := g.challenge(ip, request.FormValue("challenge"), request.FormValue("nonce")); challenge != "" {
+				writeJSON(writer, http.StatusPreconditionRequired, ChallengeResult{
+					Challenge:  challenge,
+					Difficulty: g.config.Abuse.ChallengeDifficulty,
+				})
+				// Unsolved challenges still count, or a client could send
+				// guesses forever without ever being blocked
+				g.record(ip, true, false)
+				return
+			}
+		}
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+		// Uploads count as guesses, but aren't challenged as they're sent
+		// by a plain form
+		guess := (request.URL.Path == "/guess" || request.URL.Path == "/submit") && request.Method == http.MethodPost
+		notFound := (strings.HasPrefix(request.URL.Path, "/puzzles/") && recorder.status == http.StatusNotFound) ||
+			(guess && recorder.status == http.StatusBadRequest)
+		g.record(ip, guess, notFound)
+	})
+}
+
+// statusRecorder keeps track of the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming responses can still be flushed.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// handleBlock blocks or unblocks an address or range from the admin page.
+func handleBlock(guard *abuseGuard) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		address := request.FormValue("address")
+		var err error
+		switch request.FormValue("action") {
+		case "block":
+			err = guard.Block(address)
+		case "unblock":
+			err = guard.Unblock(address)
+		default:
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("%s %sed from the admin page", address, request.FormValue("action"))
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
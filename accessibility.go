@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const accessibleCookie = "poozles_accessible"
+
+var (
+	imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+	mediaExtensions = []string{".mp3", ".wav", ".ogg", ".m4a", ".mp4", ".webm"}
+)
+
+// MediaMeta describes text alternatives for one of a puzzle's files.
+type MediaMeta struct {
+	// Alt is the alt text for an image.
+	Alt string `yaml:"alt"`
+	// Transcript is a file in the puzzle's folder with a transcript of an
+	// audio or video file.
+	Transcript string `yaml:"transcript"`
+	// Alternative is a file in the puzzle's folder to serve in place of this
+	// one to teams that have turned on accessible versions.
+	Alternative string `yaml:"alternative"`
+}
+
+// checkMedia makes sure any files mentioned in a puzzle's media metadata
+// exist, and warns about images and audio or video without text alternatives.
+func checkMedia(puzzle *Puzzle) error {
+	for name, media := range puzzle.Metadata.Media {
+		for _, file := range []string{name, media.Transcript, media.Alternative} {
+			if _, ok := puzzle.Checksums[file]; file != "" && !ok {
+				return fmt.Errorf("media refers to %q, which does not exist", file)
+			}
+		}
+	}
+	for _, file := range puzzle.Files {
+		media := puzzle.Metadata.Media[file]
+		extension := strings.ToLower(path.Ext(file))
+		if slices.Contains(imageExtensions, extension) && media.Alt == "" && media.Alternative == "" && !isAlternative(puzzle, file) {
+			log.Printf("WARNING: puzzles/%s/%s has no alt text", puzzle.Dir, file)
+		}
+		if slices.Contains(mediaExtensions, extension) && media.Transcript == "" && media.Alternative == "" && !isAlternative(puzzle, file) {
+			log.Printf("WARNING: puzzles/%s/%s has no transcript", puzzle.Dir, file)
+		}
+	}
+	return nil
+}
+
+// isAlternative returns whether the file is itself an alternative version of
+// another file.
+func isAlternative(puzzle *Puzzle, file string) bool {
+	for _, media := range puzzle.Metadata.Media {
+		if media.Alternative == file {
+			return true
+		}
+	}
+	return false
+}
+
+// accessibleVersions returns whether the team has asked to be sent the
+// accessible versions of files.
+func accessibleVersions(request *http.Request) bool {
+	cookie, err := request.Cookie(accessibleCookie)
+	return err == nil && cookie.Value == "1"
+}
+
+// handleAccessibility turns accessible versions on or off, then sends the
+// team back to the page they were on.
+func handleAccessibility(writer http.ResponseWriter, request *http.Request) {
+	cookie := &http.Cookie{
+		Name:     accessibleCookie,
+		Value:    "1",
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if request.FormValue("enabled") != "true" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(writer, cookie)
+	target := request.FormValue("return")
+	if !localTarget(target) {
+		target = "/"
+	}
+	http.Redirect(writer, request, target, http.StatusSeeOther)
+}
+
+// localTarget returns whether a redirect target is a path on this site.
+// Browsers treat a backslash like a slash, so "/\example.com" is as much
+// another site as "//example.com" is.
+func localTarget(target string) bool {
+	if len(target) > 1 && (target[1] == '/' || target[1] == '\\') {
+		return false
+	}
+	parsed, err := url.Parse(target)
+	return err == nil && parsed.Scheme == "" && parsed.Host == "" && strings.HasPrefix(parsed.Path, "/")
+}
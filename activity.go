@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultActivitySize = 50
+
+// ActivityConfig controls the public activity feed.
+type ActivityConfig struct {
+	// HidePuzzles leaves out which puzzle was solved or unlocked, for hunts
+	// where that would give too much away to other teams.
+	HidePuzzles bool `yaml:"hide_puzzles"`
+	// Size is how many recent items the feed shows.
+	Size int `yaml:"size"`
+}
+
+// ActivityItem is one entry in the activity feed. Guesses are never shown,
+// so answers can't leak through the feed.
+type ActivityItem struct {
+	Time time.Time `json:"time"`
+	// Kind is the kind of event the item came from: "solve", "unlock" or
+	// "announcement".
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// ActivityFeed keeps the most recent solves, unlocks and announcements, and
+// sends new ones to subscribers as they're added.
+type ActivityFeed struct {
+	config      *Config
+	puzzles     *PuzzleStore
+	mutex       sync.RWMutex
+	items       []ActivityItem
+	subscribers map[chan ActivityItem]struct{}
+	closed      bool
+	// shown are the solves and unlocks already in the feed, by team, puzzle
+	// and part, so a team guessing the same answer again can't flood it.
+	shown map[string]bool
+}
+
+func newActivityFeed(config *Config, store *PuzzleStore) *ActivityFeed {
+	return &ActivityFeed{
+		config:      config,
+		puzzles:     store,
+		subscribers: make(map[chan ActivityItem]struct{}),
+		shown:       make(map[string]bool),
+	}
+}
+
+// describe returns the feed item for an event, if it should be shown.
+func (f *ActivityFeed) describe(event Event) (ActivityItem, bool) {
+	item := ActivityItem{Time: event.Time, Kind: event.Event}
+	title := ""
+	if puzzle := f.puzzles.Load().Lookup(event.Puzzle); puzzle != nil && !f.config.Activity.HidePuzzles {
+		title = puzzle.Metadata.Title
+	}
+	switch {
+	case event.Event == "solve" && title != "":
+		item.Text = fmt.Sprintf("A team solved %s", title)
+	case event.Event == "solve":
+		item.Text = "A team solved a puzzle"
+	case event.Event == "unlock" && title != "":
+		item.Text = fmt.Sprintf("A team unlocked part %d of %s", event.Part, title)
+	case event.Event == "unlock":
+		item.Text = "A team unlocked a new part of a puzzle"
+	case event.Event == "announcement":
+		item.Text = event.Message
+	default:
+		return item, false
+	}
+	return item, true
+}
+
+// Record adds an event to the feed, if it's one that should be shown and
+// the team's solve or unlock isn't there already.
+func (f *ActivityFeed) Record(event Event) {
+	item, ok := f.describe(event)
+	if !ok {
+		return
+	}
+	if event.Team != "" && event.Event != "announcement" {
+		key := fmt.Sprintf("%s\x00%s\x00%s\x00%d", event.Event, event.Team, event.Puzzle, event.Part)
+		f.mutex.Lock()
+		shown := f.shown[key]
+		f.shown[key] = true
+		f.mutex.Unlock()
+		if shown {
+			return
+		}
+	}
+	f.Add(item)
+}
+
+// Add puts an item at the top of the feed, and sends it to subscribers.
+func (f *ActivityFeed) Add(item ActivityItem) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.items = append([]ActivityItem{item}, f.items...)
+	if len(f.items) > f.config.Activity.Size {
+		f.items = f.items[:f.config.Activity.Size]
+	}
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- item:
+		default:
+		}
+	}
+}
+
+// Replace swaps the items in the feed for new ones, newest first, without
+// sending them to subscribers.
+func (f *ActivityFeed) Replace(items []ActivityItem) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.items = items[:min(len(items), f.config.Activity.Size)]
+}
+
+// Subscribe returns a channel that receives every item added from now on.
+// Items are dropped if the subscriber can't keep up. The channel is closed
+// when the feed is.
+func (f *ActivityFeed) Subscribe() chan ActivityItem {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	items := make(chan ActivityItem, 16)
+	if f.closed {
+		close(items)
+		return items
+	}
+	f.subscribers[items] = struct{}{}
+	return items
+}
+
+// Unsubscribe stops sending items to a channel returned by Subscribe.
+func (f *ActivityFeed) Unsubscribe(items chan ActivityItem) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.subscribers[items]; ok {
+		delete(f.subscribers, items)
+		close(items)
+	}
+}
+
+// Close disconnects all subscribers, so streams finish when the server is
+// shutting down.
+func (f *ActivityFeed) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	for subscriber := range f.subscribers {
+		delete(f.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// Items returns the items in the feed, newest first.
+func (f *ActivityFeed) Items() []ActivityItem {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return append([]ActivityItem(nil), f.items...)
+}
+
+// serveActivity shows the activity feed. With ?embed=1 it leaves out
+// everything else, for showing in an iframe or on a projector.
+func serveActivity(config *Config, feed *ActivityFeed) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !config.Features.Enabled("activity") {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		renderTemplate(writer, config, "activity.html", ActivityView{
+			Items: feed.Items(),
+			Size:  config.Activity.Size,
+			Embed: request.FormValue("embed") == "1",
+		})
+	}
+}
+
+func serveActivityJSON(config *Config, feed *ActivityFeed) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !config.Features.Enabled("activity") {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(writer, http.StatusOK, feed.Items())
+	}
+}
+
+// streamActivity sends new feed items as server-sent events as they happen.
+func streamActivity(config *Config, feed *ActivityFeed) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !config.Features.Enabled("activity") {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		controller := http.NewResponseController(writer)
+		items := feed.Subscribe()
+		defer feed.Unsubscribe(items)
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-store")
+		writer.WriteHeader(http.StatusOK)
+		if err := controller.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-request.Context().Done():
+				return
+			case item, ok := <-items:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(item)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(writer, "data: %s\n\n", data); err != nil {
+					return
+				}
+				if err := controller.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func handleAnnouncement(hub *EventHub) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		message := request.FormValue("message")
+		if message == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hub.Publish(Event{Event: "announcement", Message: message})
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
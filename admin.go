@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// requireAdmin only lets requests through from organisers whose role has
+// the given permission (or any organiser, if it's empty), using HTTP basic
+// auth. State-changing requests must also come from the site itself, so other
+// sites can't make an organiser's browser submit them.
+func requireAdmin(config *Config, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		role, ok := adminRole(config, request)
+		if !ok {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="poozles admin"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !hasPermission(role, permission) {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		// Admin pages should never end up in the offline cache
+		writer.Header().Set("Cache-Control", "no-store")
+		if request.Method != http.MethodGet && !sameOrigin(request) {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if request.Method != http.MethodGet {
+			name, _, _ := request.BasicAuth()
+			log.Printf("Admin %s (%s): %s %s", name, role, request.Method, request.URL.Path)
+		}
+		next(writer, request)
+	}
+}
+
+func sameOrigin(request *http.Request) bool {
+	if request.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == request.Host
+}
+
+type adminPage struct {
+	Head HeadView
+	// Can is what the organiser viewing the page is allowed to do, so
+	// controls they can't use can be left out.
+	Can map[string]bool
+	// Charts show how many solves, guesses and active teams there have been
+	// recently.
+	Charts   []Chart
+	Features []Feature
+	Puzzles  []Puzzle
+	// PendingReload is a reload with changed answers waiting to be
+	// confirmed.
+	PendingReload *PuzzleDiff
+	// Versions are the sets of puzzles that have been served, newest first,
+	// which can be rolled back to.
+	Versions []PuzzleVersion
+	// Submissions are the uploaded answers waiting to be reviewed.
+	Submissions []Submission
+	// WrongGuesses are the most common wrong guesses for each puzzle.
+	WrongGuesses []WrongGuessSummary
+	// Blocked are the addresses and ranges blocked until they're unblocked,
+	// and AutomaticBlocks the clients blocked for a while for making too many
+	// requests.
+	Blocked         []string
+	AutomaticBlocks []AutomaticBlock
+}
+
+// adminWrongGuesses is how many of the most common wrong guesses are shown
+// for each puzzle.
+const adminWrongGuesses = 5
+
+func serveAdmin(config *Config, store *PuzzleStore, journal *Journal, submissions *Submissions, wrongGuesses *WrongGuesses, guard *abuseGuard) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		role, _ := adminRole(config, request)
+		blocked, automaticBlocks := guard.Blocks()
+		renderTemplate(writer, config, "admin.html", adminPage{
+			Blocked:         blocked,
+			AutomaticBlocks: automaticBlocks,
+			Can:             permissions(role),
+			PendingReload:   store.PendingDiff(),
+			Versions:        store.Versions(),
+			Charts:          dashboardCharts(journal.Since(time.Now().Add(-dashboardWindow)), time.Now()),
+			Features:        config.Features.All(),
+			Puzzles:         foundPuzzles.Puzzles,
+			Submissions:     submissions.Pending(),
+			WrongGuesses:    wrongGuesses.summarise(foundPuzzles, adminWrongGuesses),
+		})
+	}
+}
+
+func handleFeature(config *Config) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		name := request.FormValue("feature")
+		enabled := request.FormValue("enabled") == "true"
+		if err := config.Features.Set(name, enabled); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Printf("Feature %s turned %s from the admin page", name, map[bool]string{true: "on", false: "off"}[enabled])
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
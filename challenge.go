@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// challengeValidity is how long a client has to solve a challenge.
+const challengeValidity = 2 * time.Minute
+
+// ChallengeResult is returned instead of checking a guess when the client
+// has to solve a proof-of-work challenge first. A nonce solves it if the
+// SHA-256 hash of the challenge followed by the nonce starts with at least
+// Difficulty zero bits. The guess is then sent again with the challenge and
+// the nonce.
+type ChallengeResult struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// challenge returns a proof-of-work challenge for the client to solve before
+// their guess is checked, or "" if they don't need to (or have sent a
+// solution). Challenges are signed rather than stored, so a client can have
+// several on the go at once, but each one only lets one guess through.
+func (g *abuseGuard) challenge(ip string, challenge string, nonce string) string {
+	limit := g.config.Abuse.ChallengeGuessesPerMinute
+	if limit == 0 {
+		return ""
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.activity(ip).guesses < limit {
+		return ""
+	}
+	if expiry, ok := g.checkChallenge(ip, challenge); ok && solvesChallenge(challenge, nonce, g.config.Abuse.ChallengeDifficulty) {
+		if _, used := g.usedChallenges[challenge]; !used {
+			g.usedChallenges[challenge] = expiry
+			return ""
+		}
+	}
+	return g.newChallenge(ip, time.Now().Add(challengeValidity))
+}
+
+// newChallenge creates a challenge for the client, which expires at the
+// given time.
+func (g *abuseGuard) newChallenge(ip string, expiry time.Time) string {
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	unsigned := strconv.FormatInt(expiry.Unix(), 10) + "." + hex.EncodeToString(random)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(g.challengeMAC(ip, unsigned))
+}
+
+// checkChallenge returns whether the challenge was issued to the client and
+// hasn't expired, and when it expires.
+func (g *abuseGuard) checkChallenge(ip string, challenge string) (time.Time, bool) {
+	separator := strings.LastIndex(challenge, ".")
+	if separator == -1 {
+		return time.Time{}, false
+	}
+	unsigned, mac := challenge[:separator], challenge[separator+1:]
+	expires, _, _ := strings.Cut(unsigned, ".")
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > seconds {
+		return time.Time{}, false
+	}
+	macBytes, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(macBytes, g.challengeMAC(ip, unsigned)) {
+		return time.Time{}, false
+	}
+	// It's still accepted during the second it expires in
+	return time.Unix(seconds+1, 0), true
+}
+
+func (g *abuseGuard) challengeMAC(ip string, unsigned string) []byte {
+	mac := hmac.New(sha256.New, []byte(g.config.Secret))
+	mac.Write([]byte("challenge\x00" + ip + "\x00" + unsigned))
+	return mac.Sum(nil)
+}
+
+func solvesChallenge(challenge string, nonce string, difficulty int) bool {
+	hash := sha256.Sum256([]byte(challenge + nonce))
+	zeros := 0
+	for _, b := range hash {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
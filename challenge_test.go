@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newChallengeGuard returns an abuse guard that challenges every guess after
+// the first each minute, with challenges that are quick to solve.
+func newChallengeGuard() *abuseGuard {
+	return newAbuseGuard(&Config{
+		Secret: "test secret",
+		Abuse: AbuseConfig{
+			MaxGuessesPerMinute:       10,
+			MaxNotFoundPerMinute:      10,
+			BlockDuration:             time.Minute,
+			ChallengeGuessesPerMinute: 1,
+			ChallengeDifficulty:       4,
+		},
+	})
+}
+
+// solveChallenge finds a nonce that solves the challenge.
+func solveChallenge(tb testing.TB, challenge string, difficulty int) string {
+	tb.Helper()
+	for i := range 1 << 16 {
+		if nonce := strconv.Itoa(i); solvesChallenge(challenge, nonce, difficulty) {
+			return nonce
+		}
+	}
+	tb.Fatal("couldn't solve the challenge")
+	return ""
+}
+
+func TestChallenge(t *testing.T) {
+	guard := newChallengeGuard()
+	const ip = "192.0.2.1"
+	if challenge := guard.challenge(ip, "", ""); challenge != "" {
+		t.Fatal("challenged a client that hasn't guessed yet")
+	}
+	guard.record(ip, true, false)
+	challenge := guard.challenge(ip, "", "")
+	if challenge == "" {
+		t.Fatal("didn't challenge a client over the limit")
+	}
+	nonce := solveChallenge(t, challenge, 4)
+	if _, ok := guard.checkChallenge("192.0.2.2", challenge); ok {
+		t.Error("accepted a challenge issued to another client")
+	}
+	guard.record("192.0.2.2", true, false)
+	if next := guard.challenge("192.0.2.2", challenge, nonce); next == "" {
+		t.Error("let another client through with the challenge")
+	}
+	if next := guard.challenge(ip, challenge, nonce); next != "" {
+		t.Error("didn't let the client through with a solution")
+	}
+	if next := guard.challenge(ip, challenge, nonce); next == "" {
+		t.Error("let the client through again with the same solution")
+	}
+}
+
+func TestChallengeExpired(t *testing.T) {
+	guard := newChallengeGuard()
+	const ip = "192.0.2.1"
+	guard.record(ip, true, false)
+	challenge := guard.newChallenge(ip, time.Now().Add(-time.Minute))
+	if _, ok := guard.checkChallenge(ip, challenge); ok {
+		t.Error("accepted an expired challenge")
+	}
+	if next := guard.challenge(ip, challenge, solveChallenge(t, challenge, 4)); next == "" {
+		t.Error("let the client through with an expired challenge")
+	}
+	if _, ok := guard.checkChallenge(ip, guard.newChallenge(ip, time.Now().Add(time.Minute))); !ok {
+		t.Error("rejected a challenge that hasn't expired")
+	}
+}
+
+func TestChallengedGuessesCount(t *testing.T) {
+	guard := newChallengeGuard()
+	handler := guard.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNotFound)
+	}))
+	var status int
+	for range 20 {
+		form := url.Values{"puzzle": {"puzzle-1"}, "guess": {"wrong"}}
+		request := httptest.NewRequest(http.MethodPost, "/guess", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		status = recorder.Code
+	}
+	if status != http.StatusForbidden {
+		t.Errorf("ignoring challenges: got %d, wanted the client blocked", status)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// serveManifest lists the checksums of every listed puzzle's files, keyed by
+// puzzle ID and then file name. It's empty before the hunt starts.
+func serveManifest(config *Config, store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		manifest := make(map[string]map[string]string)
+		if !puzzlesOpen(config) {
+			writeJSON(writer, http.StatusOK, manifest)
+			return
+		}
+		for _, puzzle := range foundPuzzles.Listed {
+			manifest[puzzle.ID] = puzzle.Checksums
+		}
+		writeJSON(writer, http.StatusOK, manifest)
+	}
+}
+
+// verifyChecksums re-hashes every puzzle file and page, and logs a warning
+// for any that have changed or gone missing since the puzzles were loaded.
+// warned is what's already been warned about, by path, so each change is
+// only logged once rather than every time the files are checked.
+func verifyChecksums(foundPuzzles *Puzzles, warned map[string]string) {
+	for _, puzzle := range foundPuzzles.Puzzles {
+		for _, checksums := range []map[string]string{puzzle.Checksums, puzzle.PageChecksums} {
+			for file, expected := range checksums {
+				verifyChecksum("puzzles/"+puzzle.Dir+"/"+file, expected, warned)
+			}
+		}
+	}
+}
+
+// changedFiles returns the puzzle files that no longer match the checksums
+// recorded when the puzzles were loaded.
+func changedFiles(foundPuzzles *Puzzles) []string {
+	var changed []string
+	for _, puzzle := range foundPuzzles.Puzzles {
+		for file, expected := range puzzle.Checksums {
+			path := "puzzles/" + puzzle.Dir + "/" + file
+			if hash, err := fileHash("./" + path); err != nil || hash != expected {
+				changed = append(changed, path)
+			}
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+func verifyChecksum(path string, expected string, warned map[string]string) {
+	hash, err := fileHash("./" + path)
+	state := hash
+	if err != nil {
+		state = err.Error()
+	}
+	if state == expected {
+		delete(warned, path)
+		return
+	}
+	if warned[path] == state {
+		return
+	}
+	warned[path] = state
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("WARNING: %s has been deleted since it was loaded", path)
+	} else if err != nil {
+		log.Printf("WARNING: unable to verify %s: %v", path, err)
+	} else {
+		log.Printf("WARNING: %s has changed since it was loaded", path)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// TimeResult is returned by the time endpoint, so clients with the wrong time
+// can work out how far off their clock is.
+type TimeResult struct {
+	Time   time.Time `json:"time"`
+	UnixMS int64     `json:"unix_ms"`
+}
+
+func serveTime(writer http.ResponseWriter, request *http.Request) {
+	now := time.Now()
+	writer.Header().Set("Cache-Control", "no-store")
+	writeJSON(writer, http.StatusOK, TimeResult{
+		Time:   now,
+		UnixMS: now.UnixMilli(),
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"poozles/loadtest"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runNew scaffolds a new hunt ("new hunt [dir]") or puzzle ("new puzzle <id>").
+func runNew(args []string) {
+	var err error
+	switch {
+	case len(args) == 1 && args[0] == "hunt":
+		err = newHunt(".")
+	case len(args) == 2 && args[0] == "hunt":
+		err = newHunt(args[1])
+	case len(args) == 2 && args[0] == "puzzle":
+		err = newPuzzle(".", args[1])
+	default:
+		log.Fatal("Usage: poozles new hunt [dir] | poozles new puzzle <id>")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runExport writes one of the exports on the admin page to stdout ("export
+// <name>.csv" or "export <name>.json"), from the journal file and the
+// puzzles in the current folder, so results can be pulled out after the
+// server has stopped.
+func runExport(args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: poozles export <puzzles|teams|guesses>.<csv|json>")
+	}
+	config := getConfig()
+	if config.Journal == "" {
+		log.Fatal("There's nothing to export without a journal in config.yml")
+	}
+	contents, err := os.ReadFile(config.Journal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	foundPuzzles, err := getPuzzles()
+	if err != nil {
+		log.Fatal(err)
+	}
+	kind, format, _ := strings.Cut(args[0], ".")
+	header, rows, value, ok := exportTable(foundPuzzles, parseJournal(config.Journal, contents), kind)
+	if !ok {
+		log.Fatalf("Unknown export %q", kind)
+	}
+	if err := writeExport(os.Stdout, format, header, rows, value); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runLoadTest(args []string) {
+	flags := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	opts := loadtest.Options{}
+	flags.StringVar(&opts.BaseURL, "url", "http://localhost:8080", "address of the poozles instance to test")
+	flags.IntVar(&opts.Teams, "teams", 10, "number of teams to simulate")
+	flags.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to run the test for")
+	flags.DurationVar(&opts.Think, "think", time.Second, "how long each team waits between requests")
+	_ = flags.Parse(args)
+
+	log.Printf("Simulating %d teams against %s for %s", opts.Teams, opts.BaseURL, opts.Duration)
+	report, err := loadtest.Run(context.Background(), opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var kinds []string
+	for kind := range report {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "request\trequests\terrors\tp50\tp90\tp99\tmax\t")
+	for _, kind := range kinds {
+		stats := report[kind]
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n", kind, stats.Requests, stats.Errors, stats.P50, stats.P90, stats.P99, stats.Max)
+	}
+	_ = writer.Flush()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"gopkg.in/yaml.v3"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config contains hunt-wide settings, read from config.yml if it exists.
+type Config struct {
+	// AllowIndexing lets search engines index the site. Hunts usually want
+	// this off until they're over and archived.
+	AllowIndexing bool `yaml:"allow_indexing"`
+	// Sitemap serves a sitemap.xml listing every puzzle. Requires BaseURL.
+	Sitemap bool `yaml:"sitemap"`
+	// BaseURL is the public URL the hunt is served at, e.g. https://example.com
+	BaseURL string `yaml:"base_url"`
+	// Progress is how teams' solves are tracked: "cookie" to store them in an
+	// encrypted cookie, or empty to not track them at all.
+	Progress string `yaml:"progress"`
+	// ListPuzzles adds a list of every puzzle, and links to the tag pages,
+	// to the index page below puzzles/index.html. It's off by default so
+	// hunts whose index already lists their puzzles don't show them twice.
+	ListPuzzles bool `yaml:"list_puzzles"`
+	// Start and End are when the hunt starts and ends, which decide which
+	// landing page is shown. Either can be left unset.
+	Start time.Time `yaml:"start"`
+	End   time.Time `yaml:"end"`
+	// ConfirmGuesses makes teams confirm each guess before it's checked.
+	// Puzzles can override this with "confirm" in their frontmatter.
+	ConfirmGuesses bool `yaml:"confirm_guesses"`
+	// BlockedIPs lists addresses or CIDR ranges that aren't allowed to use
+	// the site at all.
+	BlockedIPs []string `yaml:"blocked_ips"`
+	// RealIPHeader is the header a reverse proxy puts the client's address
+	// in, e.g. X-Forwarded-For. If unset the connection's address is used.
+	RealIPHeader string      `yaml:"real_ip_header"`
+	Abuse        AbuseConfig `yaml:"abuse"`
+	// CORS lets other sites use the JSON API.
+	CORS CORSConfig `yaml:"cors"`
+	// Webhooks are sent events as they happen.
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// Journal is a file to record every guess, solve and other event in, as
+	// JSON lines. It's read back on startup so the activity feed, wrong
+	// guesses and responses survive restarts.
+	Journal string `yaml:"journal"`
+	// Uploads is the folder files submitted as answers are stored in.
+	// Defaults to "uploads".
+	Uploads string `yaml:"uploads"`
+	// Activity controls the public feed of solves, unlocks and announcements.
+	Activity ActivityConfig `yaml:"activity"`
+	// Mirror is the URL of another instance to mirror. A mirror serves its
+	// own copy of the puzzles read-only, with guessing turned off and no admin
+	// pages, and copies the primary's activity feed. Nothing else is copied,
+	// so standings and exports are only available from the primary.
+	Mirror string `yaml:"mirror"`
+	// Features turns parts of the site on and off. They can also be changed
+	// from the admin page while the hunt is running.
+	Features *FeatureFlags `yaml:"features"`
+	// AdminPassword is a password for the admin pages at /admin/, with any
+	// username, that can do everything there.
+	AdminPassword string `yaml:"admin_password"`
+	// Organisers each have their own login for the admin pages, with a role
+	// that limits what they can do. If there are none and AdminPassword isn't
+	// set, the admin pages are disabled.
+	Organisers []Organiser `yaml:"organisers"`
+	// Secret is the key used to sign and encrypt cookies. If it's not set a
+	// random one is generated, and cookies and guess confirmations won't survive
+	// a restart.
+	Secret string `yaml:"secret"`
+}
+
+func getConfig() *Config {
+	config := &Config{}
+	configBytes, err := os.ReadFile("./config.yml")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+	err = yaml.Unmarshal(configBytes, config)
+	if err != nil {
+		log.Println("Unable to unmarshall config.yml")
+		log.Fatal(err)
+	}
+	if config.Features == nil {
+		config.Features = newFeatureFlags()
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	config.Mirror = strings.TrimSuffix(config.Mirror, "/")
+	if config.Mirror != "" {
+		if config.Journal != "" || len(config.Webhooks) > 0 || config.AdminPassword != "" || len(config.Organisers) > 0 {
+			log.Fatal("Mirrors don't record events or have admin pages, so can't have a journal, webhooks, admin_password or organisers")
+		}
+		_ = config.Features.Set("guessing", false)
+	}
+	if config.Sitemap && config.BaseURL == "" {
+		log.Fatal("base_url must be set to serve a sitemap")
+	}
+	if !config.Start.IsZero() && !config.End.IsZero() && !config.End.After(config.Start) {
+		log.Fatal("The hunt's end must be after its start")
+	}
+	if config.Progress != "" && config.Progress != "cookie" {
+		log.Fatalf("Unknown progress tracking %q", config.Progress)
+	}
+	if config.Abuse.MaxGuessesPerMinute == 0 {
+		config.Abuse.MaxGuessesPerMinute = defaultMaxGuessesPerMinute
+	}
+	if config.Abuse.MaxNotFoundPerMinute == 0 {
+		config.Abuse.MaxNotFoundPerMinute = defaultMaxNotFoundPerMinute
+	}
+	if config.Abuse.BlockDuration == 0 {
+		config.Abuse.BlockDuration = defaultBlockDuration
+	}
+	if config.Abuse.ChallengeDifficulty == 0 {
+		config.Abuse.ChallengeDifficulty = defaultChallengeDifficulty
+	}
+	if config.Abuse.ChallengeDifficulty < 0 || config.Abuse.ChallengeDifficulty > 32 {
+		log.Fatal("abuse challenge_difficulty must be between 1 and 32")
+	}
+	if config.Uploads == "" {
+		config.Uploads = "uploads"
+	}
+	if config.Activity.Size == 0 {
+		config.Activity.Size = defaultActivitySize
+	}
+	if len(config.CORS.AllowedMethods) == 0 {
+		config.CORS.AllowedMethods = []string{http.MethodGet, http.MethodPost}
+	}
+	for i, method := range config.CORS.AllowedMethods {
+		config.CORS.AllowedMethods[i] = strings.ToUpper(method)
+	}
+	if config.CORS.AllowCredentials && slices.Contains(config.CORS.AllowedOrigins, "*") {
+		log.Fatal("cors allow_credentials can't be used with an allowed origin of \"*\"")
+	}
+	for i, webhook := range config.Webhooks {
+		if webhook.MaxAttempts == 0 {
+			config.Webhooks[i].MaxAttempts = defaultWebhookAttempts
+		}
+		if webhook.URL == "" {
+			log.Fatal("Webhooks need a url")
+		}
+		for _, event := range webhook.Events {
+			if !slices.Contains(eventTypes, event) {
+				log.Fatalf("Unknown webhook event %q", event)
+			}
+		}
+	}
+	var organiserNames []string
+	for _, organiser := range config.Organisers {
+		if organiser.Name == "" || organiser.Password == "" {
+			log.Fatal("Organisers need a name and password")
+		}
+		if _, ok := roles[organiser.Role]; !ok {
+			log.Fatalf("Unknown role %q for organiser %s", organiser.Role, organiser.Name)
+		}
+		if slices.Contains(organiserNames, organiser.Name) {
+			log.Fatalf("More than one organiser is called %s", organiser.Name)
+		}
+		organiserNames = append(organiserNames, organiser.Name)
+	}
+	if config.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+		config.Secret = hex.EncodeToString(secret)
+		if config.Progress != "" {
+			log.Println("No secret configured; progress will be lost when the server restarts")
+		}
+	}
+	return config
+}
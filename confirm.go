@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// confirmationValidity is how long a team has to confirm a guess.
+const confirmationValidity = 5 * time.Minute
+
+// ConfirmationResult is returned by the guess endpoint when a guess needs to
+// be confirmed. Resubmitting Guess along with Token commits it.
+type ConfirmationResult struct {
+	Guess string `json:"guess"`
+	Token string `json:"token"`
+}
+
+// canonicalGuess normalises the whitespace in a guess, so what's echoed back
+// for confirmation is exactly what will be checked.
+func canonicalGuess(guess string) string {
+	return strings.Join(strings.Fields(guess), " ")
+}
+
+// needsConfirmation returns whether guesses for the puzzle must be confirmed
+// before they're checked.
+func needsConfirmation(config *Config, puzzle *Puzzle) bool {
+	if puzzle.Metadata.Confirm != nil {
+		return *puzzle.Metadata.Confirm
+	}
+	return config.ConfirmGuesses
+}
+
+// confirmationToken creates a token allowing the given guess to be submitted
+// for a puzzle until the expiry time.
+func confirmationToken(config *Config, puzzleID string, guess string, expiry time.Time) string {
+	expires := strconv.FormatInt(expiry.Unix(), 10)
+	return expires + "." + base64.RawURLEncoding.EncodeToString(confirmationMAC(config, puzzleID, guess, expires))
+}
+
+// checkConfirmationToken returns whether the token was issued for the given
+// guess and puzzle, and hasn't expired.
+func checkConfirmationToken(config *Config, puzzleID string, guess string, token string) bool {
+	expires, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+	macBytes, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(macBytes, confirmationMAC(config, puzzleID, guess, expires))
+}
+
+func confirmationMAC(config *Config, puzzleID string, guess string, expires string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.Secret))
+	mac.Write([]byte("confirm\x00" + puzzleID + "\x00" + guess + "\x00" + expires))
+	return mac.Sum(nil)
+}
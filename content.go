@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// expandShortcodes runs content from a puzzle (or one of its parts) through
+// the shortcode pipeline, returning the content to serve. Shortcodes use
+// template syntax:
+//
+//	{{file "grid.png"}}             a link to one of the puzzle's files, with a content hash
+//	{{alt "grid.png"}}              the alt text given for a file in the puzzle's media metadata
+//	{{transcript "clue.mp3"}}       a link to the transcript given for a file, if it has one
+//	{{hintbox}}                     a collapsible box listing the puzzle's hints
+//	{{spoiler}}...{{endspoiler}}    text hidden until it's clicked or hovered
+//	{{ifsolved "slug"}}...{{endif}} content only shown to teams that have solved another puzzle
+//	{{ifafter "time"}}...{{endif}}  content only shown after an RFC 3339 time
+//	{{otherwise}}                   separates content shown instead when an ifsolved or ifafter doesn't apply
+//
+// Conditional blocks are left as markers, and evaluated for each team when
+// the content's served by conditionalContent. They can't be nested.
+func expandShortcodes(puzzle *Puzzle, meta *Puzzlemeta, content string) (string, error) {
+	t, err := texttemplate.New(puzzle.Dir).Funcs(texttemplate.FuncMap{
+		"file": func(name string) (string, error) {
+			if _, ok := puzzle.Checksums[name]; !ok {
+				return "", fmt.Errorf("file %q does not exist", name)
+			}
+			return url.PathEscape(name) + "?v=" + puzzle.Checksums[name][:8], nil
+		},
+		"alt": func(name string) string {
+			return template.HTMLEscapeString(puzzle.Metadata.Media[name].Alt)
+		},
+		"transcript": func(name string) string {
+			transcript := puzzle.Metadata.Media[name].Transcript
+			if transcript == "" {
+				return ""
+			}
+			return `<a class="transcript" href="` + url.PathEscape(transcript) + "?v=" + puzzle.Checksums[transcript][:8] + `">Transcript</a>`
+		},
+		"hintbox": func() string {
+			if len(meta.Hints) == 0 {
+				return ""
+			}
+			var box strings.Builder
+			box.WriteString(`<details class="hintbox"><summary>Hints</summary><ol>`)
+			for _, hint := range meta.Hints {
+				box.WriteString("<li>" + template.HTMLEscapeString(hint) + "</li>")
+			}
+			box.WriteString("</ol></details>")
+			return box.String()
+		},
+		"spoiler": func() string {
+			return spoilerMarker + `<span class="spoiler" tabindex="0">`
+		},
+		"endspoiler": func() string {
+			return "</span>" + endSpoilerMarker
+		},
+		"ifsolved": func(id string) string {
+			return "<!--poozles:if solved " + url.PathEscape(id) + "-->"
+		},
+		"ifafter": func(when string) (string, error) {
+			after, err := time.Parse(time.RFC3339, when)
+			if err != nil {
+				return "", fmt.Errorf("invalid ifafter time %q: %w", when, err)
+			}
+			return "<!--poozles:if after " + strconv.FormatInt(after.Unix(), 10) + "-->", nil
+		},
+		"otherwise": func() string {
+			return otherwiseMarker
+		},
+		"endif": func() string {
+			return "<!--poozles:endif-->"
+		},
+	}).Parse(content)
+	if err != nil {
+		return "", shortcodeError(err)
+	}
+	var expanded strings.Builder
+	err = t.Execute(&expanded, nil)
+	if err != nil {
+		return "", shortcodeError(err)
+	}
+	if strings.Contains(conditionPattern.ReplaceAllString(expanded.String(), ""), "<!--poozles:") {
+		return "", fmt.Errorf("ifsolved, ifafter, otherwise and endif must be used in matching pairs, and not nested")
+	}
+	return expanded.String(), nil
+}
+
+// shortcodeError explains how to get a literal "{{" when content written
+// before shortcodes existed fails to expand.
+func shortcodeError(err error) error {
+	return fmt.Errorf(`%w (everything between "{{" and "}}" is a shortcode; write {{"{{"}} for a literal "{{")`, err)
+}
+
+// spoilerMarker and endSpoilerMarker surround the markup from the spoiler
+// shortcodes, so spoilers can be found again even if they contain other
+// spans or spoilers.
+const (
+	spoilerMarker    = "<!--spoiler-->"
+	endSpoilerMarker = "<!--endspoiler-->"
+)
+
+const otherwiseMarker = "<!--poozles:otherwise-->"
+
+// conditionPattern matches the markers left by the ifsolved and ifafter
+// shortcodes, and the content between them.
+var conditionPattern = regexp.MustCompile(`(?s)<!--poozles:if (solved|after) (\S+?)-->(.*?)<!--poozles:endif-->`)
+
+// conditionalContent evaluates the conditional blocks in some content for a
+// team, keeping only the content that applies to them.
+func conditionalContent(progress *Progress, content string) string {
+	now := time.Now()
+	return conditionPattern.ReplaceAllStringFunc(content, func(block string) string {
+		match := conditionPattern.FindStringSubmatch(block)
+		then, otherwise, _ := strings.Cut(match[3], otherwiseMarker)
+		met := false
+		switch match[1] {
+		case "solved":
+			met = progress.IsSolved(match[2])
+		case "after":
+			unix, _ := strconv.ParseInt(match[2], 10, 64)
+			met = !now.Before(time.Unix(unix, 0))
+		}
+		if met {
+			return then
+		}
+		return otherwise
+	})
+}
+
+// solvedConditions returns the IDs of the puzzles that ifsolved blocks in
+// some content depend on.
+func solvedConditions(content string) []string {
+	var ids []string
+	for _, match := range conditionPattern.FindAllStringSubmatch(content, -1) {
+		if match[1] == "solved" {
+			ids = append(ids, match[2])
+		}
+	}
+	return ids
+}
+
+// puzzleAssets returns the URLs and integrity hashes of scripts or styles in
+// a puzzle's folder.
+func puzzleAssets(puzzle *Puzzle, names []string) ([]Asset, error) {
+	var assets []Asset
+	for _, name := range names {
+		checksum, ok := puzzle.Checksums[name]
+		if !ok {
+			return nil, fmt.Errorf("file %q does not exist", name)
+		}
+		hash, err := hex.DecodeString(checksum)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, Asset{
+			URL:       "/puzzles/" + url.PathEscape(puzzle.ID) + "/" + url.PathEscape(name) + "?v=" + checksum[:8],
+			Integrity: "sha256-" + base64.StdEncoding.EncodeToString(hash),
+		})
+	}
+	return assets, nil
+}
+
+// fileHash returns the hex-encoded SHA-256 hash of a file's contents.
+func fileHash(path string) (string, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(fileBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// hintboxPattern matches the markup added by the hintbox shortcode.
+var hintboxPattern = regexp.MustCompile(`(?s)<details class="hintbox">.*?</details>`)
+
+// forTeam returns a copy of the puzzle with its content as it should be
+// shown to a team.
+func forTeam(config *Config, progress *Progress, puzzle *Puzzle) *Puzzle {
+	shown := *puzzle
+	shown.Content = teamContent(config, progress, puzzle.Content)
+	shown.Parts = nil
+	for _, part := range puzzle.Parts {
+		part.Content = teamContent(config, progress, part.Content)
+		shown.Parts = append(shown.Parts, part)
+	}
+	return &shown
+}
+
+// teamContent returns content to send to a team, with its conditional blocks
+// evaluated, and without its hint boxes if hints are turned off.
+func teamContent(config *Config, progress *Progress, content string) string {
+	if !config.Features.Enabled("hints") {
+		content = hintboxPattern.ReplaceAllString(content, "")
+	}
+	return conditionalContent(progress, content)
+}
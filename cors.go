@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORSConfig controls which other sites can call the JSON API and event
+// stream from a browser.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins that can make requests, e.g.
+	// https://app.example.com, or "*" for any.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowCredentials lets requests include cookies. It can't be used with
+	// an origin of "*".
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// AllowedMethods lists the methods other origins can use. Defaults to
+	// GET and POST.
+	AllowedMethods []string `yaml:"allowed_methods"`
+}
+
+// corsPath returns whether a path is part of the API that other origins can
+// be allowed to use. Pages and the admin area never are.
+func corsPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/guess"
+}
+
+// corsHeaders adds CORS headers to API responses for allowed origins, and
+// answers preflight requests.
+func corsHeaders(config *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		if origin == "" || len(config.CORS.AllowedOrigins) == 0 || !corsPath(request.URL.Path) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		writer.Header().Add("Vary", "Origin")
+		allowed := slices.Contains(config.CORS.AllowedOrigins, origin)
+		if !allowed && !slices.Contains(config.CORS.AllowedOrigins, "*") {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		if allowed {
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+		} else {
+			writer.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		if config.CORS.AllowCredentials {
+			writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != "" {
+			writer.Header().Set("Access-Control-Allow-Methods", strings.Join(config.CORS.AllowedMethods, ", "))
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			writer.Header().Set("Access-Control-Max-Age", "600")
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !slices.Contains(config.CORS.AllowedMethods, request.Method) {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	chartHeight   = 100
+	chartBarWidth = 10
+)
+
+// Chart is a bar chart of how many events happened (or how many teams were
+// active) in each period of time, drawn as an SVG on the admin page.
+type Chart struct {
+	Title  string
+	Width  int
+	Height int
+	Max    int
+	Bars   []ChartBar
+}
+
+// ChartBar is one bar of a chart, already positioned within it.
+type ChartBar struct {
+	X, Y, Width, Height int
+	// Label describes the bar's period and count, shown when it's hovered.
+	Label string
+}
+
+// newChart counts the events that match in each of the given number of
+// periods leading up to now.
+func newChart(title string, events []Event, match func(Event) bool, period time.Duration, periods int, now time.Time) Chart {
+	start := chartStart(period, periods, now)
+	counts := make([]int, periods)
+	for _, event := range events {
+		if !match(event) || event.Time.Before(start) {
+			continue
+		}
+		if i := int(event.Time.Sub(start) / period); i < periods {
+			counts[i]++
+		}
+	}
+	return drawChart(title, counts, start, period)
+}
+
+// newDistinctChart counts the different non-empty keys of events in each of
+// the given number of periods leading up to now, such as how many teams did
+// something.
+func newDistinctChart(title string, events []Event, key func(Event) string, period time.Duration, periods int, now time.Time) Chart {
+	start := chartStart(period, periods, now)
+	seen := make([]map[string]bool, periods)
+	counts := make([]int, periods)
+	for _, event := range events {
+		value := key(event)
+		if value == "" || event.Time.Before(start) {
+			continue
+		}
+		i := int(event.Time.Sub(start) / period)
+		if i >= periods || seen[i][value] {
+			continue
+		}
+		if seen[i] == nil {
+			seen[i] = make(map[string]bool)
+		}
+		seen[i][value] = true
+		counts[i]++
+	}
+	return drawChart(title, counts, start, period)
+}
+
+// chartStart returns the start of the first of the given number of periods
+// leading up to now.
+func chartStart(period time.Duration, periods int, now time.Time) time.Time {
+	return now.Truncate(period).Add(-time.Duration(periods-1) * period)
+}
+
+// drawChart positions a bar for each count, the first of which is for the
+// period beginning at start.
+func drawChart(title string, counts []int, start time.Time, period time.Duration) Chart {
+	chart := Chart{Title: title, Width: len(counts) * chartBarWidth, Height: chartHeight, Max: 1}
+	for _, count := range counts {
+		chart.Max = max(chart.Max, count)
+	}
+	for i, count := range counts {
+		height := count * chartHeight / chart.Max
+		chart.Bars = append(chart.Bars, ChartBar{
+			X:      i * chartBarWidth,
+			Y:      chartHeight - height,
+			Width:  chartBarWidth - 2,
+			Height: height,
+			Label:  fmt.Sprintf("%s: %d", start.Add(time.Duration(i)*period).Format("15:04"), count),
+		})
+	}
+	return chart
+}
+
+// dashboardWindow is how far back the longest chart on the admin page goes.
+const dashboardWindow = 24 * time.Hour
+
+// dashboardCharts returns the charts of solves, guesses and active teams
+// shown on the admin page, to help judge the pace of the hunt, from the events in the last
+// dashboardWindow.
+func dashboardCharts(events []Event, now time.Time) []Chart {
+	return []Chart{
+		newChart("Solves per hour, last 24 hours", events, func(event Event) bool {
+			return event.Event == "solve"
+		}, time.Hour, 24, now),
+		newChart("Guesses per minute, last hour", events, func(event Event) bool {
+			return event.Event == "guess"
+		}, time.Minute, 60, now),
+		newDistinctChart("Active teams per hour, last 24 hours", events, func(event Event) string {
+			return event.Team
+		}, time.Hour, 24, now),
+	}
+}
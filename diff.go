@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PuzzleDiff describes what changed when the puzzles were reloaded.
+type PuzzleDiff struct {
+	Time    time.Time
+	Added   []string
+	Removed []string
+	Changed []PuzzleChange
+}
+
+// PuzzleChange describes how one puzzle changed on reload.
+type PuzzleChange struct {
+	Puzzle string
+	// Content is whether the puzzle's content, or any of its frontmatter
+	// other than its answers, changed.
+	Content bool
+	// Answers is whether the answers for the puzzle, or any of its parts,
+	// changed.
+	Answers      bool
+	AddedFiles   []string
+	RemovedFiles []string
+	ChangedFiles []string
+}
+
+// diffPuzzles compares two sets of puzzles by ID.
+func diffPuzzles(old, new *Puzzles) *PuzzleDiff {
+	diff := &PuzzleDiff{Time: time.Now()}
+	for _, puzzle := range old.Puzzles {
+		if new.Lookup(puzzle.ID) == nil {
+			diff.Removed = append(diff.Removed, puzzle.ID)
+		}
+	}
+	for _, puzzle := range new.Puzzles {
+		previous := old.Lookup(puzzle.ID)
+		if previous == nil {
+			diff.Added = append(diff.Added, puzzle.ID)
+			continue
+		}
+		change := PuzzleChange{
+			Puzzle:  puzzle.ID,
+			Content: !reflect.DeepEqual(withoutAnswers(previous), withoutAnswers(&puzzle)),
+			Answers: !reflect.DeepEqual(answersOf(previous), answersOf(&puzzle)),
+		}
+		for file, checksum := range puzzle.Checksums {
+			previousChecksum, ok := previous.Checksums[file]
+			if !ok {
+				change.AddedFiles = append(change.AddedFiles, file)
+			} else if previousChecksum != checksum {
+				change.ChangedFiles = append(change.ChangedFiles, file)
+			}
+		}
+		for file := range previous.Checksums {
+			if _, ok := puzzle.Checksums[file]; !ok {
+				change.RemovedFiles = append(change.RemovedFiles, file)
+			}
+		}
+		slices.Sort(change.AddedFiles)
+		slices.Sort(change.RemovedFiles)
+		slices.Sort(change.ChangedFiles)
+		if change.Content || change.Answers || len(change.AddedFiles) > 0 || len(change.RemovedFiles) > 0 || len(change.ChangedFiles) > 0 {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	return diff
+}
+
+// puzzleAnswers is everything that decides whether a guess is right.
+type puzzleAnswers struct {
+	Answers    []Answer
+	SubAnswers []AnswerGroup
+	Type       string
+	Tolerance  float64
+	Units      string
+}
+
+func metaAnswers(meta Puzzlemeta) puzzleAnswers {
+	return puzzleAnswers{meta.Answers, meta.SubAnswers, meta.Type, meta.Tolerance, meta.Units}
+}
+
+// answersOf returns the answers for a puzzle and each of its parts.
+func answersOf(puzzle *Puzzle) []puzzleAnswers {
+	answers := []puzzleAnswers{metaAnswers(puzzle.Metadata)}
+	for _, part := range puzzle.Parts {
+		answers = append(answers, metaAnswers(part.Metadata))
+	}
+	return answers
+}
+
+// withoutAnswers returns a copy of a puzzle with the answers cleared, so the
+// rest of it can be compared. Files are compared separately, by checksum.
+func withoutAnswers(puzzle *Puzzle) Puzzle {
+	stripped := *puzzle
+	stripped.Metadata = clearAnswers(puzzle.Metadata)
+	stripped.Parts = nil
+	for _, part := range puzzle.Parts {
+		part.Metadata = clearAnswers(part.Metadata)
+		stripped.Parts = append(stripped.Parts, part)
+	}
+	stripped.Files = nil
+	stripped.Checksums = nil
+	stripped.PageChecksums = nil
+	stripped.Scripts = nil
+	stripped.Styles = nil
+	return stripped
+}
+
+func clearAnswers(meta Puzzlemeta) Puzzlemeta {
+	meta.Answers, meta.SubAnswers, meta.Type, meta.Tolerance, meta.Units = nil, nil, "", 0, ""
+	return meta
+}
+
+// NeedsConfirmation returns whether the reload changes or removes any
+// answers, so an organiser should check it before it takes effect.
+func (d *PuzzleDiff) NeedsConfirmation() bool {
+	return len(d.Removed) > 0 || slices.ContainsFunc(d.Changed, func(change PuzzleChange) bool {
+		return change.Answers
+	})
+}
+
+// Empty returns whether nothing changed.
+func (d *PuzzleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Summary describes the changes, one line per puzzle, for logging.
+func (d *PuzzleDiff) Summary() []string {
+	var lines []string
+	for _, id := range d.Added {
+		lines = append(lines, "added "+id)
+	}
+	for _, id := range d.Removed {
+		lines = append(lines, "removed "+id)
+	}
+	for _, change := range d.Changed {
+		var parts []string
+		if change.Content {
+			parts = append(parts, "content changed")
+		}
+		if change.Answers {
+			parts = append(parts, "answers changed")
+		}
+		for _, files := range []struct {
+			verb  string
+			names []string
+		}{{"added", change.AddedFiles}, {"removed", change.RemovedFiles}, {"changed", change.ChangedFiles}} {
+			if len(files.names) > 0 {
+				parts = append(parts, fmt.Sprintf("%s %s", files.verb, strings.Join(files.names, ", ")))
+			}
+		}
+		lines = append(lines, change.Puzzle+": "+strings.Join(parts, "; "))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "nothing changed")
+	}
+	return lines
+}
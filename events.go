@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// eventTypes lists the kinds of Event that are published.
+var eventTypes = []string{"guess", "solve", "unlock", "announcement", "response"}
+
+// Event is published when something happens in the hunt.
+type Event struct {
+	// Event is the kind of event: "guess", "solve", "unlock" (when solving
+	// one part of a multi-stage puzzle reveals the next), "announcement", or
+	// "response" (when an organiser sets the message for a wrong guess).
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Team is the ID of the team whose guess, solve or unlock it was, if
+	// progress is tracked.
+	Team   string `json:"team,omitempty"`
+	Puzzle string `json:"puzzle,omitempty"`
+	Part   int    `json:"part,omitempty"`
+	Guess  string `json:"guess,omitempty"`
+	// Result is whether a guess was "correct", matched a "subanswer", or was
+	// "incorrect". Files uploaded as answers are "submitted", with the file's
+	// name as the guess.
+	Result string `json:"result,omitempty"`
+	// Message is the text of an announcement or response.
+	Message string `json:"message,omitempty"`
+}
+
+// EventHub passes events on to everything that's interested in them.
+// Handlers are called for every event as it's published.
+type EventHub struct {
+	mutex    sync.Mutex
+	handlers []func(Event)
+}
+
+func newEventHub() *EventHub {
+	return &EventHub{}
+}
+
+// Handle registers a function to be called with every event. It's called
+// synchronously, so shouldn't block.
+func (h *EventHub) Handle(handler func(Event)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.handlers = append(h.handlers, handler)
+}
+
+// Publish sends an event to every handler. The time is set while holding
+// the lock, so handlers always see events in time order.
+func (h *EventHub) Publish(event Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	event.Time = time.Now()
+	for _, handler := range h.handlers {
+		handler(event)
+	}
+}
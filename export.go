@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PuzzleStats summarises the guesses and solves for one puzzle.
+type PuzzleStats struct {
+	Puzzle     string     `json:"puzzle"`
+	Title      string     `json:"title"`
+	Guesses    int        `json:"guesses"`
+	Incorrect  int        `json:"incorrect"`
+	Solves     int        `json:"solves"`
+	FirstSolve *time.Time `json:"first_solve,omitempty"`
+	LastSolve  *time.Time `json:"last_solve,omitempty"`
+}
+
+// puzzleStats works out the stats for every puzzle from the events in the
+// journal.
+func puzzleStats(foundPuzzles *Puzzles, events []Event) []PuzzleStats {
+	stats := make([]PuzzleStats, len(foundPuzzles.Puzzles))
+	byID := make(map[string]*PuzzleStats, len(stats))
+	for i, puzzle := range foundPuzzles.Puzzles {
+		stats[i] = PuzzleStats{Puzzle: puzzle.ID, Title: puzzle.Metadata.Title}
+		byID[puzzle.ID] = &stats[i]
+	}
+	for _, event := range events {
+		puzzle, ok := byID[event.Puzzle]
+		if !ok {
+			continue
+		}
+		switch event.Event {
+		case "guess":
+			puzzle.Guesses++
+			if event.Result == "incorrect" {
+				puzzle.Incorrect++
+			}
+		case "solve":
+			puzzle.Solves++
+			if puzzle.FirstSolve == nil {
+				puzzle.FirstSolve = &event.Time
+			}
+			puzzle.LastSolve = &event.Time
+		}
+	}
+	return stats
+}
+
+// TeamStats summarises how one team has done, for the standings.
+type TeamStats struct {
+	Team      string     `json:"team"`
+	Solves    int        `json:"solves"`
+	Guesses   int        `json:"guesses"`
+	LastSolve *time.Time `json:"last_solve,omitempty"`
+}
+
+// teamStats works out the standings from the events in the journal: most
+// solves first, then whoever got there first. Teams are only known if
+// progress is tracked, so events without a team are left out.
+func teamStats(events []Event) []TeamStats {
+	var stats []TeamStats
+	byTeam := make(map[string]int)
+	for _, event := range events {
+		if event.Team == "" || (event.Event != "guess" && event.Event != "solve") {
+			continue
+		}
+		i, ok := byTeam[event.Team]
+		if !ok {
+			i = len(stats)
+			byTeam[event.Team] = i
+			stats = append(stats, TeamStats{Team: event.Team})
+		}
+		if event.Event == "guess" {
+			stats[i].Guesses++
+		} else {
+			stats[i].Solves++
+			stats[i].LastSolve = &event.Time
+		}
+	}
+	slices.SortStableFunc(stats, func(a, b TeamStats) int {
+		if a.Solves != b.Solves {
+			return b.Solves - a.Solves
+		}
+		if a.LastSolve == nil || b.LastSolve == nil {
+			return 0
+		}
+		return a.LastSolve.Compare(*b.LastSolve)
+	})
+	return stats
+}
+
+// exportTable returns the rows of an export, for CSV, and the value to
+// encode for JSON. The kind is "puzzles" for each puzzle's stats, "teams"
+// for the standings or "guesses" for every guess made.
+func exportTable(foundPuzzles *Puzzles, events []Event, kind string) ([]string, [][]string, any, bool) {
+	var header []string
+	var rows [][]string
+	switch kind {
+	case "puzzles":
+		stats := puzzleStats(foundPuzzles, events)
+		header = []string{"puzzle", "title", "guesses", "incorrect", "solves", "first_solve", "last_solve"}
+		for _, puzzle := range stats {
+			rows = append(rows, []string{
+				puzzle.Puzzle,
+				puzzle.Title,
+				strconv.Itoa(puzzle.Guesses),
+				strconv.Itoa(puzzle.Incorrect),
+				strconv.Itoa(puzzle.Solves),
+				formatExportTime(puzzle.FirstSolve),
+				formatExportTime(puzzle.LastSolve),
+			})
+		}
+		return header, rows, stats, true
+	case "teams":
+		stats := teamStats(events)
+		header = []string{"team", "solves", "guesses", "last_solve"}
+		for _, team := range stats {
+			rows = append(rows, []string{
+				team.Team,
+				strconv.Itoa(team.Solves),
+				strconv.Itoa(team.Guesses),
+				formatExportTime(team.LastSolve),
+			})
+		}
+		return header, rows, stats, true
+	case "guesses":
+		guesses := []Event{}
+		header = []string{"time", "team", "puzzle", "part", "guess", "result"}
+		for _, event := range events {
+			if event.Event != "guess" {
+				continue
+			}
+			guesses = append(guesses, event)
+			rows = append(rows, []string{
+				formatExportTime(&event.Time),
+				event.Team,
+				event.Puzzle,
+				strconv.Itoa(event.Part),
+				spreadsheetSafe(event.Guess),
+				event.Result,
+			})
+		}
+		return header, rows, guesses, true
+	default:
+		return nil, nil, nil, false
+	}
+}
+
+// writeExport writes an export as "csv" or "json".
+func writeExport(output io.Writer, format string, header []string, rows [][]string, value any) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(output).Encode(value)
+	case "csv":
+		writer := csv.NewWriter(output)
+		_ = writer.Write(header)
+		return writer.WriteAll(rows)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// serveExport serves the results of the hunt for downloading, from the
+// events in the journal. The name is one of the kinds exportTable knows, with
+// ".csv" or ".json".
+func serveExport(store *PuzzleStore, journal *Journal) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		name := request.PathValue("name")
+		kind, format, _ := strings.Cut(name, ".")
+		header, rows, value, ok := exportTable(foundPuzzles, journal.Events(), kind)
+		if !ok || (format != "csv" && format != "json") {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if format == "csv" {
+			writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			writer.Header().Set("Content-Type", "application/json")
+		}
+		writer.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		if err := writeExport(writer, format, header, rows, value); err != nil {
+			log.Printf("Unable to write %s export: %v", name, err)
+		}
+	}
+}
+
+// spreadsheetSafe stops text teams typed in from being treated as a formula
+// when a CSV export is opened in a spreadsheet.
+func spreadsheetSafe(text string) string {
+	if text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"slices"
+	"sync"
+)
+
+// featureNames lists the features that can be turned on and off while the
+// hunt is running. They all default to on.
+var featureNames = []string{
+	// hints shows the hint boxes added with the hintbox shortcode
+	"hints",
+	// guessing accepts guesses
+	"guessing",
+	// search shows the search box and page
+	"search",
+	// activity shows the feed of recent solves, unlocks and announcements
+	"activity",
+}
+
+// FeatureFlags holds which features are turned on. Flags start off as set in
+// the config, and can be changed from the admin page without restarting.
+type FeatureFlags struct {
+	mutex sync.RWMutex
+	flags map[string]bool
+}
+
+func newFeatureFlags() *FeatureFlags {
+	flags := &FeatureFlags{flags: make(map[string]bool)}
+	for _, name := range featureNames {
+		flags.flags[name] = true
+	}
+	return flags
+}
+
+func (f *FeatureFlags) UnmarshalYAML(node *yaml.Node) error {
+	var flags map[string]bool
+	if err := node.Decode(&flags); err != nil {
+		return err
+	}
+	*f = *newFeatureFlags()
+	for name, enabled := range flags {
+		if !slices.Contains(featureNames, name) {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		f.flags[name] = enabled
+	}
+	return nil
+}
+
+// Enabled returns whether the named feature is turned on.
+func (f *FeatureFlags) Enabled(name string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.flags[name]
+}
+
+// Set turns the named feature on or off.
+func (f *FeatureFlags) Set(name string, enabled bool) error {
+	if !slices.Contains(featureNames, name) {
+		return fmt.Errorf("unknown feature %q", name)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.flags[name] = enabled
+	return nil
+}
+
+// Feature is the state of a single feature flag.
+type Feature struct {
+	Name    string
+	Enabled bool
+}
+
+// All returns the state of every feature, in a consistent order.
+func (f *FeatureFlags) All() []Feature {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	var features []Feature
+	for _, name := range featureNames {
+		features = append(features, Feature{Name: name, Enabled: f.flags[name]})
+	}
+	return features
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// journalBuffer is how many events can be waiting to be written to the
+// journal file before publishing more has to wait for them.
+const journalBuffer = 1024
+
+// Journal keeps every event published during the hunt. If a journal file is
+// configured, events are also appended to it as JSON lines, and read back
+// when the server starts, so nothing is lost over a restart without needing a
+// database. Lines are written by a separate goroutine, so a slow disk doesn't
+// hold up guesses.
+type Journal struct {
+	mutex   sync.RWMutex
+	file    *os.File
+	events  []Event
+	lines   chan []byte
+	written chan struct{}
+}
+
+// openJournal reads the events already in the journal file, if there is one,
+// and opens it to append new events to.
+func openJournal(config *Config) *Journal {
+	journal := &Journal{}
+	if config.Journal == "" {
+		return journal
+	}
+	contents, err := os.ReadFile(config.Journal)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+	journal.events = parseJournal(config.Journal, contents)
+	if len(contents) > 0 {
+		log.Printf("Read %d events from %s", len(journal.events), config.Journal)
+	}
+	journal.file, err = os.OpenFile(config.Journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(contents) > 0 && contents[len(contents)-1] != '\n' {
+		// Don't let the next event run on from a partly written one
+		if _, err := journal.file.Write([]byte("\n")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	journal.lines = make(chan []byte, journalBuffer)
+	journal.written = make(chan struct{})
+	go journal.write(journal.file)
+	return journal
+}
+
+// parseJournal reads the events from the contents of a journal file.
+func parseJournal(path string, contents []byte) []Event {
+	var events []Event
+	for i, line := range bytes.Split(contents, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			// Most likely the server stopped part way through writing an
+			// event, so it's not worth refusing to start over.
+			log.Printf("Skipping invalid event on line %d of %s: %v", i+1, path, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// write appends lines to the journal file until the journal is closed.
+func (j *Journal) write(file *os.File) {
+	defer close(j.written)
+	for line := range j.lines {
+		if _, err := file.Write(line); err != nil {
+			log.Printf("Unable to write an event to the journal: %v", err)
+		}
+	}
+}
+
+// Record adds an event to the journal.
+func (j *Journal) Record(event Event) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.events = append(j.events, event)
+	if j.file == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Unable to encode %s event: %v", event.Event, err)
+		return
+	}
+	j.lines <- append(line, '\n')
+}
+
+// Events returns every event in the journal, oldest first.
+func (j *Journal) Events() []Event {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	return append([]Event(nil), j.events...)
+}
+
+// Since returns the events in the journal from the given time onwards,
+// oldest first, without going through the ones before it.
+func (j *Journal) Since(start time.Time) []Event {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	i, _ := slices.BinarySearchFunc(j.events, start, func(event Event, start time.Time) int {
+		return event.Time.Compare(start)
+	})
+	return append([]Event(nil), j.events[i:]...)
+}
+
+// Close writes any events still waiting to the journal file, and closes it.
+func (j *Journal) Close() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file != nil {
+		close(j.lines)
+		<-j.written
+		if err := j.file.Close(); err != nil {
+			log.Printf("Unable to close the journal: %v", err)
+		}
+		j.file = nil
+	}
+}
@@ -1,19 +1,205 @@
+// The difference between the server's clock and ours. Anything time-based
+// should use serverNow() rather than trusting the local clock.
+let clockOffset = 0
+const serverTime = document.querySelector('meta[name="server-time"]')
+if (serverTime) {
+  clockOffset = Number(serverTime.content) - Date.now()
+}
+
+export const serverNow = () => new Date(Date.now() + clockOffset)
+
+// syncClock refines the offset using the time endpoint, allowing for how
+// long the request took.
+const syncClock = async () => {
+  const sent = Date.now()
+  const response = await fetch('/api/time', {cache: 'no-store'})
+  const received = Date.now()
+  const result = await response.json()
+  clockOffset = result.unix_ms - (sent + received) / 2
+}
+
+// Elements with a data-countdown attribute (a unix timestamp in milliseconds)
+// show the time remaining until then.
+const countdowns = document.querySelectorAll('[data-countdown]')
+
+const formatRemaining = (ms) => {
+  const seconds = Math.max(0, Math.ceil(ms / 1000))
+  const hours = Math.floor(seconds / 3600)
+  const minutes = Math.floor(seconds / 60) % 60
+  const pad = (n) => String(n).padStart(2, '0')
+  return `${hours}:${pad(minutes)}:${pad(seconds % 60)}`
+}
+
+const updateCountdowns = () => {
+  const now = serverNow().getTime()
+  countdowns.forEach((element) => {
+    element.textContent = formatRemaining(Number(element.dataset.countdown) - now)
+  })
+}
+
+if (countdowns.length > 0) {
+  updateCountdowns()
+  setInterval(updateCountdowns, 1000)
+  syncClock().then(updateCountdowns).catch(console.log)
+}
+
 const root = document.getElementById('input')
-if (root) {
-  document.getElementById('input').onsubmit = async (event) => {
-    event.preventDefault()
-    const formData= new FormData(event.target)
-    const response = await fetch('/guess', {
+const subAnswers = document.getElementById('subanswers')
+// If the server tracks progress it renders the found sub-answers itself,
+// otherwise they're kept in local storage.
+const tracked = subAnswers && subAnswers.hasAttribute('data-tracked')
+
+const foundKey = () => 'poozles:subanswers:' + root.elements.puzzle.value
+
+const loadFound = () => JSON.parse(localStorage.getItem(foundKey()) || '{}')
+
+const renderFound = (found) => {
+  const list = subAnswers.querySelector('ul')
+  list.replaceChildren(...Object.values(found).map((answer) => {
+    const item = document.createElement('li')
+    item.textContent = answer
+    return item
+  }))
+  subAnswers.querySelector('.count').textContent = Object.keys(found).length
+}
+
+const addFound = (answer, count) => {
+  const list = subAnswers.querySelector('ul')
+  if (![...list.children].some((item) => item.textContent === answer)) {
+    const item = document.createElement('li')
+    item.textContent = answer
+    list.append(item)
+  }
+  subAnswers.querySelector('.count').textContent = count
+}
+
+// The activity feed adds new items as they happen.
+const activity = document.getElementById('activity')
+if (activity) {
+  const stream = new EventSource('/api/activity/stream')
+  stream.onmessage = (message) => {
+    const item = JSON.parse(message.data)
+    const entry = document.createElement('li')
+    entry.className = item.kind
+    const time = document.createElement('time')
+    time.dateTime = item.time
+    time.textContent = new Date(item.time).toLocaleTimeString([], {hour: '2-digit', minute: '2-digit'})
+    entry.append(time, ' ', item.text)
+    activity.prepend(entry)
+    while (activity.children.length > Number(activity.dataset.size)) {
+      activity.lastElementChild.remove()
+    }
+  }
+}
+
+if ('serviceWorker' in navigator) {
+  navigator.serviceWorker.register('/sw.js').catch(console.log)
+}
+
+// solveChallenge finds a nonce that, added to the end of the challenge, gives
+// a SHA-256 hash starting with enough zero bits. The server asks for this
+// when a lot of guesses are being made.
+const solveChallenge = async (challenge, difficulty) => {
+  const encoder = new TextEncoder()
+  for (let nonce = 0; ; nonce++) {
+    const hash = new Uint8Array(await crypto.subtle.digest('SHA-256', encoder.encode(challenge + nonce)))
+    let zeros = 0
+    for (const byte of hash) {
+      zeros += Math.clz32(byte) - 24
+      if (byte !== 0) {
+        break
+      }
+    }
+    if (zeros >= difficulty) {
+      return String(nonce)
+    }
+  }
+}
+
+// maxChallenges is how many proof-of-work challenges in a row a guess is
+// retried for before giving up.
+const maxChallenges = 3
+
+const submitGuess = async (formData, challenges = 0) => {
+  let response
+  try {
+    response = await fetch('/guess', {
       method: 'POST',
       body: formData
     })
-    if (response.status === 200) {
+  } catch (err) {
+    alert("Couldn't submit your guess - are you offline?")
+    return
+  }
+  if (response.status === 200) {
+    const result = await response.json()
+    if (result.content) {
+      const part = document.createElement('section')
+      part.className = 'part'
+      part.innerHTML = result.content
+      document.getElementById('parts').append(part)
+      root.elements.part.value = result.part
+    }
+    alert(result.message || 'yay')
+    if (result.redirect) {
+      window.location.href = result.redirect
+    }
+  } else if (response.status === 202) {
+    const result = await response.json()
+    let count = result.found
+    if (tracked) {
+      addFound(result.answer, count)
+    } else {
+      const found = loadFound()
+      found[result.subanswer] = result.answer
+      localStorage.setItem(foundKey(), JSON.stringify(found))
+      renderFound(found)
+      count = Object.keys(found).length
+    }
+    if (count === result.total) {
       alert('yay')
-    } else if (response.status === 404) {
-      alert('boo')
     } else {
-      alert('wtf')
-      console.log(response)
+      alert(`Found ${count} of ${result.total}`)
+    }
+  } else if (response.status === 409) {
+    const result = await response.json()
+    if (confirm(`Submit "${result.guess}"?`)) {
+      formData.set('guess', result.guess)
+      formData.set('token', result.token)
+      await submitGuess(formData)
     }
+  } else if (response.status === 428) {
+    if (challenges >= maxChallenges) {
+      alert("You're guessing too quickly - wait a minute and try again")
+      return
     }
+    const result = await response.json()
+    formData.set('challenge', result.challenge)
+    formData.set('nonce', await solveChallenge(result.challenge, result.difficulty))
+    await submitGuess(formData, challenges + 1)
+  } else if (response.status === 503) {
+    alert('Guessing is closed')
+  } else if (response.status === 410) {
+    alert('This puzzle has been withdrawn')
+  } else if (response.status === 404) {
+    if (response.headers.get('Content-Type') === 'application/json') {
+      const result = await response.json()
+      alert(result.message)
+    } else {
+      alert('boo')
+    }
+  } else {
+    alert('wtf')
+    console.log(response)
+  }
+}
+
+if (root) {
+  if (subAnswers && !tracked) {
+    renderFound(loadFound())
+  }
+  document.getElementById('input').onsubmit = async (event) => {
+    event.preventDefault()
+    await submitGuess(new FormData(event.target))
+  }
 }
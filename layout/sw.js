@@ -0,0 +1,46 @@
+// Service worker that keeps copies of pages and files the team has already
+// been served, so they can keep reading puzzles without a connection. Only
+// successful responses the server actually sent are cached, so puzzles or
+// parts the team hasn't unlocked never end up in the cache.
+const CACHE = 'poozles'
+
+const cacheable = (url) => url.origin === self.location.origin &&
+  !url.pathname.startsWith('/admin/') &&
+  !url.pathname.startsWith('/api/') &&
+  url.pathname !== '/search' &&
+  url.pathname !== '/activity' &&
+  url.pathname !== '/sw.js'
+
+self.addEventListener('install', () => {
+  self.skipWaiting()
+})
+
+self.addEventListener('activate', (event) => {
+  event.waitUntil(self.clients.claim())
+})
+
+self.addEventListener('fetch', (event) => {
+  const request = event.request
+  if (request.method !== 'GET' || !cacheable(new URL(request.url))) {
+    return
+  }
+  // Always try the network first so teams see the latest content, and only
+  // fall back to the cache when offline.
+  event.respondWith((async () => {
+    const cache = await caches.open(CACHE)
+    try {
+      const response = await fetch(request)
+      const cacheControl = response.headers.get('Cache-Control') || ''
+      if (response.ok && !response.redirected && !cacheControl.includes('no-store')) {
+        await cache.put(request, response.clone())
+      }
+      return response
+    } catch (err) {
+      const cached = await cache.match(request)
+      if (cached) {
+        return cached
+      }
+      throw err
+    }
+  })())
+})
@@ -0,0 +1,203 @@
+// Package loadtest simulates teams browsing and guessing against a running
+// poozles instance, and reports how long the server took to respond.
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a load test.
+type Options struct {
+	// BaseURL is the address of the instance to test, e.g. http://localhost:8080
+	BaseURL string
+	// Teams is the number of simulated teams making requests at once.
+	Teams int
+	// Duration is how long to run the test for.
+	Duration time.Duration
+	// Think is how long each team pauses between requests.
+	Think time.Duration
+}
+
+// Stats summarises the requests of one kind made during a load test. The
+// percentiles are only of the requests that succeeded, so quick refusals
+// such as the abuse guard's blocks and challenges don't flatter them.
+type Stats struct {
+	Requests int
+	Errors   int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Report contains Stats for each kind of request made: "index", "puzzle",
+// "file" and "guess".
+type Report map[string]Stats
+
+type recorder struct {
+	mutex     sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (r *recorder) record(kind string, latency time.Duration, failed bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if failed {
+		r.errors[kind]++
+	} else {
+		r.latencies[kind] = append(r.latencies[kind], latency)
+	}
+}
+
+// Run simulates opts.Teams teams using the site until opts.Duration has passed
+// or ctx is cancelled.
+func Run(ctx context.Context, opts Options) (Report, error) {
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	client := &http.Client{Timeout: 30 * time.Second}
+	manifest, err := getManifest(ctx, client, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("no puzzles found on %s", baseURL)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	results := &recorder{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+	var wg sync.WaitGroup
+	for range opts.Teams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTeam(ctx, client, baseURL, manifest, opts.Think, results)
+		}()
+	}
+	wg.Wait()
+
+	report := make(Report)
+	for kind, count := range results.errors {
+		report[kind] = Stats{Requests: count, Errors: count}
+	}
+	for kind, latencies := range results.latencies {
+		slices.Sort(latencies)
+		report[kind] = Stats{
+			Requests: len(latencies) + results.errors[kind],
+			Errors:   results.errors[kind],
+			P50:      percentile(latencies, 0.5),
+			P90:      percentile(latencies, 0.9),
+			P99:      percentile(latencies, 0.99),
+			Max:      latencies[len(latencies)-1],
+		}
+	}
+	return report, nil
+}
+
+// getManifest fetches the puzzle IDs and files from the server's manifest.
+func getManifest(ctx context.Context, client *http.Client, baseURL string) (map[string]map[string]string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/manifest", nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get manifest: %s", response.Status)
+	}
+	manifest := make(map[string]map[string]string)
+	err = json.NewDecoder(response.Body).Decode(&manifest)
+	return manifest, err
+}
+
+func runTeam(ctx context.Context, client *http.Client, baseURL string, manifest map[string]map[string]string, think time.Duration, results *recorder) {
+	var puzzles []string
+	for id := range manifest {
+		puzzles = append(puzzles, id)
+	}
+	for ctx.Err() == nil {
+		puzzle := puzzles[rand.IntN(len(puzzles))]
+		puzzleURL := baseURL + "/puzzles/" + url.PathEscape(puzzle) + "/"
+		switch n := rand.IntN(10); {
+		case n < 2:
+			doRequest(ctx, client, results, "index", http.MethodGet, baseURL+"/", nil)
+		case n < 6:
+			doRequest(ctx, client, results, "puzzle", http.MethodGet, puzzleURL, nil)
+		case n < 8 && len(manifest[puzzle]) > 0:
+			for file := range manifest[puzzle] {
+				doRequest(ctx, client, results, "file", http.MethodGet, puzzleURL+url.PathEscape(file), nil)
+				break
+			}
+		default:
+			form := url.Values{"puzzle": {puzzle}, "guess": {fmt.Sprintf("guess%d", rand.IntN(1000))}}
+			doRequest(ctx, client, results, "guess", http.MethodPost, baseURL+"/guess", form)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(think):
+		}
+	}
+}
+
+func doRequest(ctx context.Context, client *http.Client, results *recorder, kind string, method string, target string, form url.Values) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		results.record(kind, 0, true)
+		return
+	}
+	if form != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	start := time.Now()
+	response, err := client.Do(request)
+	if ctx.Err() != nil {
+		// The test finished while the request was in flight
+		if err == nil {
+			_ = response.Body.Close()
+		}
+		return
+	}
+	if err != nil {
+		results.record(kind, time.Since(start), true)
+		return
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+	results.record(kind, time.Since(start), !expectedStatus(kind, response.StatusCode))
+}
+
+// expectedStatus returns whether a response is what a working instance would
+// send. Wrong guesses are not found, and guesses for puzzles that need them
+// confirmed are conflicts; anything else that isn't a success or redirect,
+// such as being blocked or challenged, is an error.
+func expectedStatus(kind string, status int) bool {
+	if kind == "guess" && (status == http.StatusNotFound || status == http.StatusConflict) {
+		return true
+	}
+	return status >= 200 && status < 400
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
@@ -0,0 +1,122 @@
+package loadtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeHunt serves just enough of a poozles instance for a load test: a
+// manifest with one puzzle and one file, and pages that respond instantly.
+func fakeHunt() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/manifest", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"example":{"grid.png":"0123456789abcdef"}}`))
+	})
+	mux.HandleFunc("GET /{$}", func(writer http.ResponseWriter, request *http.Request) {})
+	mux.HandleFunc("GET /puzzles/example/", func(writer http.ResponseWriter, request *http.Request) {})
+	mux.HandleFunc("POST /guess", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNotFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestRun(t *testing.T) {
+	server := fakeHunt()
+	defer server.Close()
+	report, err := Run(context.Background(), Options{
+		BaseURL:  server.URL,
+		Teams:    4,
+		Duration: 200 * time.Millisecond,
+		Think:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, stats := range report {
+		if stats.Errors > 0 {
+			t.Errorf("%s: %d errors", kind, stats.Errors)
+		}
+		if stats.P50 > stats.P90 || stats.P90 > stats.P99 || stats.P99 > stats.Max {
+			t.Errorf("%s: percentiles out of order: %+v", kind, stats)
+		}
+	}
+	if report["puzzle"].Requests == 0 {
+		t.Errorf("no puzzle requests made: %+v", report)
+	}
+}
+
+func TestRunCountsRefusals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/api/manifest" {
+			_, _ = writer.Write([]byte(`{"example":{}}`))
+			return
+		}
+		if request.URL.Path == "/guess" {
+			writer.WriteHeader(http.StatusPreconditionRequired)
+			return
+		}
+		writer.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	report, err := Run(context.Background(), Options{
+		BaseURL:  server.URL,
+		Teams:    2,
+		Duration: 100 * time.Millisecond,
+		Think:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) == 0 {
+		t.Fatal("no requests made")
+	}
+	for kind, stats := range report {
+		if stats.Errors != stats.Requests || stats.Max != 0 {
+			t.Errorf("%s: refusals counted as successes: %+v", kind, stats)
+		}
+	}
+}
+
+func TestRunWithoutPuzzles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	if _, err := Run(context.Background(), Options{BaseURL: server.URL, Teams: 1, Duration: time.Second}); err == nil {
+		t.Error("expected an error for a hunt with no puzzles")
+	}
+}
+
+// BenchmarkRequest measures the overhead of making and recording one request
+// of each kind, which is the floor on the latencies a load test can report.
+func BenchmarkRequest(b *testing.B) {
+	server := fakeHunt()
+	defer server.Close()
+	client := server.Client()
+	for _, kind := range []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"index", http.MethodGet, "/"},
+		{"puzzle", http.MethodGet, "/puzzles/example/"},
+		{"guess", http.MethodPost, "/guess"},
+	} {
+		b.Run(kind.name, func(b *testing.B) {
+			results := &recorder{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+			for range b.N {
+				var form map[string][]string
+				if kind.method == http.MethodPost {
+					form = map[string][]string{"puzzle": {"example"}, "guess": {"wrong"}}
+				}
+				doRequest(context.Background(), client, results, kind.name, kind.method, server.URL+kind.path, form)
+			}
+			if results.errors[kind.name] > 0 {
+				b.Fatalf("%d requests failed", results.errors[kind.name])
+			}
+		})
+	}
+}
@@ -3,50 +3,295 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"html/template"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
 type Puzzles struct {
-	Index   string
+	Index string
+	// Landing has the pages to show instead of Index before the hunt starts
+	// and after it ends, if there are any, keyed by phase.
+	Landing map[string]string
 	Puzzles []Puzzle
+	// Listed are the Puzzles that haven't been archived, which are the ones
+	// shown on the index and in search results.
+	Listed []*Puzzle
+	// Tags lists every tag used by a puzzle, sorted alphabetically
+	Tags []string
+	// byID and byAlias index Puzzles for looking them up from URLs
+	byID    map[string]*Puzzle
+	byAlias map[string]*Puzzle
+	search  []searchEntry
 }
+
+// Lookup returns the puzzle with the given ID, or nil if there isn't one.
+func (p *Puzzles) Lookup(id string) *Puzzle {
+	return p.byID[id]
+}
+
+// LookupAlias returns the puzzle with the given alias, or nil if there isn't one.
+func (p *Puzzles) LookupAlias(alias string) *Puzzle {
+	return p.byAlias[alias]
+}
+
 type Puzzle struct {
 	ID       string
+	Dir      string
+	Aliases  []string
 	Metadata Puzzlemeta
 	Content  string
 	Files    []string
+	// Parts are the stages of a multi-stage puzzle, in order. Puzzles
+	// without parts take their answers from Metadata.
+	Parts []Part
+	// Checksums maps each of the Files to the SHA-256 hash of its contents
+	// when the puzzles were loaded. It doubles as the set of files that can
+	// be served for the puzzle.
+	Checksums map[string]string
+	// PageChecksums are the hashes of index.html and any partN.html files,
+	// which aren't served directly so aren't in Checksums.
+	PageChecksums map[string]string
+	// Scripts and Styles are the puzzle's own files to add to the page's
+	// head, from its frontmatter.
+	Scripts []Asset
+	Styles  []Asset
+}
+
+// Asset is a script or stylesheet added to a puzzle's page, with a
+// subresource integrity hash so browsers won't run it if it's changed.
+type Asset struct {
+	URL       string
+	Integrity string
+}
+
+// Part is one stage of a multi-stage puzzle, read from partN.html in the
+// puzzle's folder. Each part is revealed once the one before it is solved.
+type Part struct {
+	Metadata Puzzlemeta
+	Content  string
 }
 
 type Puzzlemeta struct {
 	Title   string   `yaml:"title"`
-	Answers []string `yaml:"answers"`
-	Hints   []string `yaml:"hints"`
+	Slug    string   `yaml:"slug"`
+	Aliases []string `yaml:"aliases"`
+	Tags    []string `yaml:"tags"`
+	// Media gives text alternatives for the puzzle's files, keyed by name.
+	Media      map[string]MediaMeta `yaml:"media"`
+	Answers    []Answer             `yaml:"answers"`
+	SubAnswers []AnswerGroup        `yaml:"subanswers"`
+	Hints      []string             `yaml:"hints"`
+	// Scripts and Styles are files in the puzzle's folder to include in the
+	// page, for interactive puzzles.
+	Scripts []string `yaml:"scripts"`
+	Styles  []string `yaml:"styles"`
+	// Responses are messages for specific wrong guesses.
+	Responses []Response `yaml:"responses"`
+	// Type is how guesses are checked: "text" (the default) for an exact
+	// match, "numeric" to compare quantities within Tolerance, in Units, or
+	// "upload" for teams to submit a file to be checked by an organiser.
+	Type      string  `yaml:"type"`
+	Tolerance float64 `yaml:"tolerance"`
+	Units     string  `yaml:"units"`
+	// Confirm overrides whether guesses need confirming for this puzzle.
+	Confirm *bool `yaml:"confirm"`
+	// Archived withdraws a puzzle, e.g. if it's broken beyond repair. It's the
+	// explanation shown to teams instead of the puzzle. Teams that solved it
+	// keep their solve.
+	Archived string `yaml:"archived"`
+	// Author, Difficulty and InternalNotes are for organisers only. They're
+	// shown on the admin page but never to teams.
+	Author        string `yaml:"author"`
+	Difficulty    string `yaml:"difficulty"`
+	InternalNotes string `yaml:"internal_notes"`
+}
+
+// matchAnswer returns the index of the answer the guess matches, or -1 if it
+// doesn't match any of them.
+func (meta Puzzlemeta) matchAnswer(guess string) int {
+	if meta.Type == "numeric" {
+		return matchNumeric(meta, guess)
+	}
+	return slices.IndexFunc(meta.Answers, func(answer Answer) bool {
+		return answer.Answer == guess
+	})
+}
+
+// wrongAnswerResponse returns the response for a wrong guess, if the puzzle
+// has one for it.
+func (meta Puzzlemeta) wrongAnswerResponse(guess string) *Response {
+	for i, response := range meta.Responses {
+		if slices.ContainsFunc(response.Guesses, func(candidate string) bool {
+			return guessKey(candidate) == guessKey(guess)
+		}) {
+			return &meta.Responses[i]
+		}
+	}
+	return nil
+}
+
+// Response is a message shown to teams when they make a particular wrong
+// guess, such as a nudge that they're on the right track. Guess can be one
+// string or a list of them.
+type Response struct {
+	Guesses AnswerGroup `yaml:"guess" json:"-"`
+	Message string      `yaml:"message" json:"message"`
+}
+
+// Answer is an accepted answer for a puzzle. In frontmatter it can be given
+// either as a plain string, or as a mapping with a message to show the team
+// and/or a URL to send them to when they submit it.
+type Answer struct {
+	Answer   string `yaml:"answer" json:"-"`
+	Message  string `yaml:"message" json:"message,omitempty"`
+	Redirect string `yaml:"redirect" json:"redirect,omitempty"`
+}
+
+func (a *Answer) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Answer)
+	}
+	type plain Answer
+	return node.Decode((*plain)(a))
+}
+
+// AnswerGroup is one of the sub-answers that must all be found to solve a
+// puzzle. Any of the strings in the group is accepted for it. In frontmatter
+// a group with a single accepted string can be given as a plain string.
+type AnswerGroup []string
+
+func (g *AnswerGroup) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var answer string
+		if err := node.Decode(&answer); err != nil {
+			return err
+		}
+		*g = AnswerGroup{answer}
+		return nil
+	}
+	return node.Decode((*[]string)(g))
+}
+
+// SubAnswerResult is returned by the guess endpoint when a guess matches one
+// of a puzzle's sub-answers. Found is only set if progress is being tracked.
+type SubAnswerResult struct {
+	SubAnswer int    `json:"subanswer"`
+	Answer    string `json:"answer"`
+	Found     int    `json:"found,omitempty"`
+	Total     int    `json:"total"`
+}
+
+// PartResult is returned by the guess endpoint when a guess solves one part
+// of a multi-stage puzzle, with the content of the next part.
+type PartResult struct {
+	Answer
+	Part    int    `json:"part"`
+	Content string `json:"content"`
+}
+
+func init() {
+	_ = mime.AddExtensionType(".webmanifest", "application/manifest+json")
 }
 
 func main() {
-	foundPuzzles := getPuzzles()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExport(os.Args[2:])
+		case "loadtest":
+			runLoadTest(os.Args[2:])
+		case "new":
+			runNew(os.Args[2:])
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		return
+	}
+	serve()
+}
+
+func serve() {
+	config := getConfig()
+	foundPuzzles, err := getPuzzles()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := newPuzzleStore(foundPuzzles)
+	hub := newEventHub()
+	webhooks := newWebhooks(config)
+	hub.Handle(webhooks.Send)
+	feed := newActivityFeed(config, store)
+	journal := openJournal(config)
+	submissions := loadSubmissions(config)
+	wrongGuesses := newWrongGuesses()
+	for _, event := range journal.Events() {
+		feed.Record(event)
+		wrongGuesses.Record(event)
+	}
+	hub.Handle(journal.Record)
+	hub.Handle(feed.Record)
+	hub.Handle(wrongGuesses.Record)
+	guard := newAbuseGuard(config)
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /main.css", serveFile("layout/main.css"))
 	mux.HandleFunc("GET /main.js", serveFile("layout/main.js"))
+	mux.HandleFunc("GET /sw.js", serveFile("layout/sw.js"))
+	mux.HandleFunc("GET /manifest.webmanifest", serveFile("layout/manifest.webmanifest"))
 	mux.HandleFunc("GET /puzzles/{id}", addTrailingSlash)
-	mux.HandleFunc("GET /puzzles/{id}/", servePuzzle(foundPuzzles))
-	mux.HandleFunc("GET /puzzles/{id}/{file}", servePuzzleFile(foundPuzzles))
-	mux.HandleFunc("GET /{$}", serveIndex(foundPuzzles))
-	mux.HandleFunc("POST /guess", handleGuess(foundPuzzles))
+	mux.HandleFunc("GET /puzzles/{id}/", servePuzzle(config, store, submissions, hub))
+	mux.HandleFunc("GET /puzzles/{id}/{file}", servePuzzleFile(config, store))
+	mux.HandleFunc("GET /{$}", serveIndex(config, store))
+	mux.HandleFunc("GET /tags/{tag}", addTrailingSlash)
+	mux.HandleFunc("GET /tags/{tag}/", serveTag(config, store))
+	mux.HandleFunc("GET /search", serveSearch(config, store))
+	mux.HandleFunc("GET /robots.txt", serveRobots(config))
+	mux.HandleFunc("GET /api/manifest", serveManifest(config, store))
+	mux.HandleFunc("GET /api/time", serveTime)
+	mux.HandleFunc("GET /activity", serveActivity(config, feed))
+	mux.HandleFunc("GET /api/activity", serveActivityJSON(config, feed))
+	mux.HandleFunc("GET /api/activity/stream", streamActivity(config, feed))
+	if config.Sitemap {
+		mux.HandleFunc("GET /sitemap.xml", serveSitemap(config, store))
+	}
+	mux.HandleFunc("POST /guess", handleGuess(config, store, hub, wrongGuesses))
+	mux.HandleFunc("POST /submit", handleSubmission(config, store, submissions, hub))
+	mux.HandleFunc("POST /accessibility", handleAccessibility)
+	if config.AdminPassword != "" || len(config.Organisers) > 0 {
+		mux.HandleFunc("GET /admin/{$}", requireAdmin(config, "", serveAdmin(config, store, journal, submissions, wrongGuesses, guard)))
+		mux.HandleFunc("POST /admin/features", requireAdmin(config, "features", handleFeature(config)))
+		mux.HandleFunc("POST /admin/announcements", requireAdmin(config, "hints", handleAnnouncement(hub)))
+		mux.HandleFunc("POST /admin/responses", requireAdmin(config, "hints", handleResponse(hub)))
+		mux.HandleFunc("GET /admin/submissions/{id}", requireAdmin(config, "hints", serveSubmission(submissions)))
+		mux.HandleFunc("POST /admin/submissions/{id}", requireAdmin(config, "hints", handleReview(submissions)))
+		mux.HandleFunc("POST /admin/reload", requireAdmin(config, "content", handleReload(store)))
+		mux.HandleFunc("POST /admin/reload/pending", requireAdmin(config, "content", handlePendingReload(store)))
+		mux.HandleFunc("POST /admin/rollback", requireAdmin(config, "content", handleRollback(store)))
+		mux.HandleFunc("POST /admin/blocks", requireAdmin(config, "blocks", handleBlock(guard)))
+		mux.HandleFunc("GET /admin/export/{name}", requireAdmin(config, "export", serveExport(store, journal)))
+	}
+	if config.Mirror != "" {
+		go syncMirror(config, feed)
+	}
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", 8080),
-		Handler: mux,
+		Handler: robotsHeader(config, corsHeaders(config, guard.middleware(mux))),
 	}
+	server.RegisterOnShutdown(feed.Close)
 
 	go func() {
 		log.Printf("Listening on port %d", 8080)
@@ -56,9 +301,24 @@ func main() {
 		log.Println("Stopped listening")
 	}()
 
+	go func() {
+		warned := make(map[string]string)
+		for range time.Tick(time.Minute) {
+			verifyChecksums(store.Load(), warned)
+			guard.prune()
+		}
+	}()
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for received := range c {
+		if received != syscall.SIGHUP {
+			break
+		}
+		if _, err := store.Reload(); err != nil {
+			log.Printf("Unable to reload puzzles: %v", err)
+		}
+	}
 
 	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownRelease()
@@ -66,187 +326,598 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Failed to shut down HTTP server: %v", err)
 	}
+	webhooks.Close(shutdownCtx)
+	journal.Close()
 }
 
 func addTrailingSlash(writer http.ResponseWriter, request *http.Request) {
 	http.Redirect(writer, request, request.URL.String()+"/", http.StatusTemporaryRedirect)
 }
 
-func servePuzzleFile(foundPuzzles *Puzzles) func(http.ResponseWriter, *http.Request) {
+func servePuzzleFile(config *Config, store *PuzzleStore) func(http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		puzzleID := request.PathValue("id")
-		index := slices.IndexFunc(foundPuzzles.Puzzles, func(puzz Puzzle) bool {
-			return puzz.ID == puzzleID
-		})
-		if index == -1 {
+		foundPuzzles := store.Load()
+		if !puzzlesOpen(config) {
 			writer.WriteHeader(http.StatusNotFound)
 			return
 		}
+		puzzleID := request.PathValue("id")
+		puzzle := foundPuzzles.Lookup(puzzleID)
 		fileName := request.PathValue("file")
-		if !slices.Contains(foundPuzzles.Puzzles[index].Files, fileName) {
+		if puzzle == nil {
+			redirectAlias(writer, request, foundPuzzles, puzzleID, fileName)
+			return
+		}
+		if puzzle.Metadata.Archived != "" {
+			writer.WriteHeader(http.StatusGone)
+			return
+		}
+		if _, ok := puzzle.Checksums[fileName]; !ok {
 			writer.WriteHeader(http.StatusNotFound)
 			return
 		}
-		serveFile("puzzles/"+puzzleID+"/"+fileName)(writer, request)
+		if alternative := puzzle.Metadata.Media[fileName].Alternative; alternative != "" {
+			writer.Header().Set("Vary", "Cookie")
+			if accessibleVersions(request) {
+				fileName = alternative
+			}
+		}
+		serveFile("puzzles/"+puzzle.Dir+"/"+fileName)(writer, request)
 	}
 }
 
+// redirectAlias sends the client to the current URL for a puzzle if the given
+// ID is one of its aliases, or responds with a 404 if no puzzle has it.
+func redirectAlias(writer http.ResponseWriter, request *http.Request, foundPuzzles *Puzzles, alias string, fileName string) {
+	puzzle := foundPuzzles.LookupAlias(alias)
+	if puzzle == nil {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	target := "/puzzles/" + url.PathEscape(puzzle.ID) + "/" + url.PathEscape(fileName)
+	if request.URL.RawQuery != "" {
+		target += "?" + request.URL.RawQuery
+	}
+	http.Redirect(writer, request, target, http.StatusMovedPermanently)
+}
+
 func serveFile(file string) func(writer http.ResponseWriter, request *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		http.ServeFile(writer, request, file)
 	}
 }
 
-func serveIndex(foundPuzzles *Puzzles) func(writer http.ResponseWriter, request *http.Request) {
+func serveIndex(config *Config, store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		templateBytes, err := os.ReadFile("layout/index.html")
-		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-			fmt.Println("Unable to read layout template")
-			fmt.Println(err)
-			return
+		foundPuzzles := store.Load()
+		progress := loadProgress(config, request)
+		content, listed := landingPage(config, foundPuzzles)
+		page := IndexView{
+			Team:    newTeamView(config, progress, request),
+			Content: content,
 		}
-		t, err := template.New("puzzle").Parse(string(templateBytes))
-		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-			fmt.Println("Unable to create template")
-			fmt.Println(err)
+		if listed && config.ListPuzzles {
+			page.Tags = foundPuzzles.Tags
+			for _, puzzle := range foundPuzzles.Listed {
+				page.Puzzles = append(page.Puzzles, newPuzzleLink(puzzle, progress))
+			}
+		}
+		renderTemplate(writer, config, "index.html", page)
+	}
+}
+
+func serveTag(config *Config, store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		tag := request.PathValue("tag")
+		content, listed := landingPage(config, foundPuzzles)
+		if !listed || !slices.Contains(foundPuzzles.Tags, tag) {
+			writer.WriteHeader(http.StatusNotFound)
 			return
 		}
-		err = t.ExecuteTemplate(writer, "puzzle", Puzzle{Content: foundPuzzles.Index})
-		if err != nil {
-			fmt.Println("Error executing template")
-			fmt.Println(err)
+		progress := loadProgress(config, request)
+		page := IndexView{
+			Team:    newTeamView(config, progress, request),
+			Content: content,
+			Tags:    foundPuzzles.Tags,
+			Tag:     tag,
+		}
+		for _, puzzle := range foundPuzzles.Listed {
+			if slices.Contains(puzzle.Metadata.Tags, tag) {
+				page.Puzzles = append(page.Puzzles, newPuzzleLink(puzzle, progress))
+			}
 		}
+		renderTemplate(writer, config, "index.html", page)
 	}
 }
 
-func servePuzzle(foundPuzzles *Puzzles) func(writer http.ResponseWriter, request *http.Request) {
+func servePuzzle(config *Config, store *PuzzleStore, submissions *Submissions, hub *EventHub) func(writer http.ResponseWriter, request *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		puzzleID := request.PathValue("id")
-		index := slices.IndexFunc(foundPuzzles.Puzzles, func(puzz Puzzle) bool {
-			return puzz.ID == puzzleID
-		})
-		if index == -1 {
+		foundPuzzles := store.Load()
+		if !puzzlesOpen(config) {
 			writer.WriteHeader(http.StatusNotFound)
 			return
 		}
-		templateBytes, err := os.ReadFile("layout/index.html")
-		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
+		puzzleID := request.PathValue("id")
+		puzzle := foundPuzzles.Lookup(puzzleID)
+		if puzzle == nil {
+			redirectAlias(writer, request, foundPuzzles, puzzleID, "")
 			return
 		}
-		t := template.New("puzzle")
-		t.Funcs(template.FuncMap{
-			"htmlSafe": func(html string) template.HTML {
-				return template.HTML(html)
-			},
-		})
-		t, err = t.Parse(string(templateBytes))
-		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
+		progress := loadProgress(config, request)
+		if puzzle.Metadata.Archived != "" {
+			writer.WriteHeader(http.StatusGone)
+			renderTemplate(writer, config, "archived.html", ArchivedView{
+				Team:    newTeamView(config, progress, request),
+				Title:   puzzle.Metadata.Title,
+				Message: puzzle.Metadata.Archived,
+				Solved:  progress.IsSolved(puzzle.ID),
+			})
 			return
 		}
-		err = t.ExecuteTemplate(writer, "puzzle", foundPuzzles.Puzzles[index])
-		if err != nil {
-			fmt.Println("Error executing template")
-			fmt.Println(err)
+		submission, changed := checkSubmission(config, submissions, hub, progress, puzzle)
+		if changed {
+			saveProgress(config, writer, request, progress)
 		}
+		puzzle = forTeam(config, progress, puzzle)
+		page := newPuzzleView(puzzle, progress, newTeamView(config, progress, request), request.URL.Path)
+		page.Submission = submission
+		renderTemplate(writer, config, "puzzle.html", page)
+	}
+}
+
+// renderTemplate executes one of the templates in the layout folder. They
+// are all parsed together, so they can share partials such as "head".
+func renderTemplate(writer http.ResponseWriter, config *Config, name string, data any) {
+	t := template.New("layout")
+	t.Funcs(template.FuncMap{
+		"htmlSafe": func(html string) template.HTML {
+			return template.HTML(html)
+		},
+		"noindex": func() bool {
+			return !config.AllowIndexing
+		},
+		"feature": config.Features.Enabled,
+		"serverTime": func() int64 {
+			return time.Now().UnixMilli()
+		},
+	})
+	t, err := t.ParseGlob("layout/*.html")
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		fmt.Println("Unable to create template")
+		fmt.Println(err)
+		return
+	}
+	err = t.ExecuteTemplate(writer, name, data)
+	if err != nil {
+		fmt.Println("Error executing template")
+		fmt.Println(err)
 	}
 }
 
-func handleGuess(foundPuzzles *Puzzles) func(writer http.ResponseWriter, request *http.Request) {
+func handleGuess(config *Config, store *PuzzleStore, hub *EventHub, wrongGuesses *WrongGuesses) func(writer http.ResponseWriter, request *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		if !config.Features.Enabled("guessing") || !puzzlesOpen(config) {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		puzzle := request.FormValue("puzzle")
-		guess := request.FormValue("guess")
+		guess := canonicalGuess(request.FormValue("guess"))
 		if puzzle == "" || guess == "" {
 			writer.WriteHeader(http.StatusBadRequest)
 			fmt.Printf("Puzzle or guess is blank")
 			return
 		}
-		index := slices.IndexFunc(foundPuzzles.Puzzles, func(puzz Puzzle) bool {
-			return puzz.ID == puzzle
-		})
-		if index == -1 {
+		found := foundPuzzles.Lookup(puzzle)
+		if found == nil {
 			writer.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if slices.Contains(foundPuzzles.Puzzles[index].Metadata.Answers, guess) {
-			writer.WriteHeader(http.StatusOK)
+		if found.Metadata.Archived != "" {
+			writer.WriteHeader(http.StatusGone)
+			return
+		}
+		if needsConfirmation(config, found) && !checkConfirmationToken(config, found.ID, guess, request.FormValue("token")) {
+			writeJSON(writer, http.StatusConflict, ConfirmationResult{
+				Guess: guess,
+				Token: confirmationToken(config, found.ID, guess, time.Now().Add(confirmationValidity)),
+			})
+			return
+		}
+		meta := found.Metadata
+		progress := loadProgress(config, request)
+		part := 0
+		if len(found.Parts) > 0 {
+			var err error
+			part, err = strconv.Atoi(request.FormValue("part"))
+			if err != nil || part < 1 || part > len(found.Parts) {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if config.Progress != "" && part > progress.PartsSolved(found.ID)+1 {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			meta = found.Parts[part-1].Metadata
+		}
+		event := Event{Event: "guess", Team: progress.Team, Puzzle: found.ID, Part: part, Guess: guess}
+		answerIndex := meta.matchAnswer(guess)
+		if answerIndex != -1 {
+			event.Result = "correct"
+			hub.Publish(event)
+			if config.Progress != "" && part > 0 && part < len(found.Parts) && progress.PartsSolved(found.ID) < part {
+				hub.Publish(Event{Event: "unlock", Team: progress.Team, Puzzle: found.ID, Part: part + 1})
+			}
+			if part > 0 {
+				progress.SolvePart(found.ID, part)
+			}
+			if part == len(found.Parts) {
+				solve(config, hub, progress, found)
+			}
+			saveProgress(config, writer, request, progress)
+			if part < len(found.Parts) {
+				writeJSON(writer, http.StatusOK, PartResult{
+					Answer:  meta.Answers[answerIndex],
+					Part:    part + 1,
+					Content: teamContent(config, progress, found.Parts[part].Content),
+				})
+				return
+			}
+			writeJSON(writer, http.StatusOK, meta.Answers[answerIndex])
+			return
+		}
+		subAnswerIndex := slices.IndexFunc(meta.SubAnswers, func(group AnswerGroup) bool {
+			return slices.Contains(group, guess)
+		})
+		if subAnswerIndex != -1 {
+			event.Result = "subanswer"
+			hub.Publish(event)
+			result := SubAnswerResult{
+				SubAnswer: subAnswerIndex,
+				Answer:    meta.SubAnswers[subAnswerIndex][0],
+				Total:     len(meta.SubAnswers),
+			}
+			if config.Progress != "" {
+				result.Found = progress.FindSubAnswer(found.ID, subAnswerIndex)
+				if result.Found == result.Total {
+					solve(config, hub, progress, found)
+				}
+				saveProgress(config, writer, request, progress)
+			}
+			writeJSON(writer, http.StatusAccepted, result)
+			return
+		}
+		event.Result = "incorrect"
+		hub.Publish(event)
+		// Saved even though nothing's changed, so a new team keeps its ID
+		saveProgress(config, writer, request, progress)
+		if response := meta.wrongAnswerResponse(guess); response != nil {
+			writeJSON(writer, http.StatusNotFound, response)
+			return
+		}
+		if message := wrongGuesses.Response(found.ID, part, guess); message != "" {
+			writeJSON(writer, http.StatusNotFound, Response{Message: message})
 			return
 		}
 		writer.WriteHeader(http.StatusNotFound)
 	}
 }
 
-func getPuzzles() *Puzzles {
+// solve marks a puzzle as solved, sending a solve event if the team hadn't
+// already solved it. Without progress tracking there's no telling whether
+// they had, so no event is sent.
+func solve(config *Config, hub *EventHub, progress *Progress, puzzle *Puzzle) {
+	if config.Progress != "" && !progress.IsSolved(puzzle.ID) {
+		hub.Publish(Event{Event: "solve", Team: progress.Team, Puzzle: puzzle.ID})
+	}
+	progress.Solve(puzzle.ID)
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	err := json.NewEncoder(writer).Encode(value)
+	if err != nil {
+		fmt.Println("Error writing JSON response")
+		fmt.Println(err)
+	}
+}
+
+// getPuzzles reads the index page and every puzzle from the puzzles folder.
+func getPuzzles() (*Puzzles, error) {
 	var foundPuzzles = &Puzzles{}
 	entries, err := os.ReadDir("./puzzles")
 	if errors.Is(err, os.ErrNotExist) {
-		log.Fatal("Puzzles folder must exist")
+		return nil, errors.New("puzzles folder must exist")
 	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	indexBytes, err := os.ReadFile("./puzzles/index.html")
 	if errors.Is(err, os.ErrNotExist) {
-		log.Fatal("puzzles/index.html - not found")
+		return nil, errors.New("puzzles/index.html - not found")
 	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	foundPuzzles.Index = string(indexBytes)
+	foundPuzzles.Landing, err = readLandingPages()
+	if err != nil {
+		return nil, err
+	}
+	usedNames := make(map[string]string)
 	for _, e := range entries {
 		if e.IsDir() {
-			foundPuzzles.Puzzles = append(foundPuzzles.Puzzles, *getPuzzle(e.Name()))
+			puzzle, err := getPuzzle(e.Name())
+			if err != nil {
+				return nil, fmt.Errorf("puzzles/%s: %w", e.Name(), err)
+			}
+			for _, name := range append([]string{puzzle.ID}, puzzle.Aliases...) {
+				if other, ok := usedNames[name]; ok {
+					return nil, fmt.Errorf("puzzles %s and %s both use the ID or alias %q", other, puzzle.Dir, name)
+				}
+				usedNames[name] = puzzle.Dir
+			}
+			foundPuzzles.Puzzles = append(foundPuzzles.Puzzles, *puzzle)
+		}
+	}
+	foundPuzzles.byID = make(map[string]*Puzzle, len(foundPuzzles.Puzzles))
+	foundPuzzles.byAlias = make(map[string]*Puzzle)
+	for i := range foundPuzzles.Puzzles {
+		puzzle := &foundPuzzles.Puzzles[i]
+		foundPuzzles.byID[puzzle.ID] = puzzle
+		for _, alias := range puzzle.Aliases {
+			foundPuzzles.byAlias[alias] = puzzle
+		}
+		if puzzle.Metadata.Archived != "" {
+			continue
+		}
+		foundPuzzles.Listed = append(foundPuzzles.Listed, puzzle)
+		foundPuzzles.search = append(foundPuzzles.search, newSearchEntry(puzzle))
+		for _, tag := range puzzle.Metadata.Tags {
+			if !slices.Contains(foundPuzzles.Tags, tag) {
+				foundPuzzles.Tags = append(foundPuzzles.Tags, tag)
+			}
+		}
+	}
+	slices.Sort(foundPuzzles.Tags)
+	for _, puzzle := range foundPuzzles.Puzzles {
+		contents := []string{puzzle.Content}
+		for _, part := range puzzle.Parts {
+			contents = append(contents, part.Content)
+		}
+		for _, content := range contents {
+			for _, id := range solvedConditions(content) {
+				if foundPuzzles.Lookup(id) == nil {
+					return nil, fmt.Errorf("%s uses ifsolved with unknown puzzle %q", puzzle.Dir, id)
+				}
+			}
 		}
 	}
-	return foundPuzzles
+	return foundPuzzles, nil
 }
 
-func getPuzzle(path string) *Puzzle {
-	indexBytes, err := os.ReadFile("./puzzles/" + path + "/index.html")
+func getPuzzle(path string) (*Puzzle, error) {
+	meta, content, err := readPage(path + "/index.html")
+	if err != nil {
+		return nil, err
+	}
+	if meta.Title == "" {
+		return nil, errors.New("puzzle needs a title")
+	}
+	var files []string
+	var partNumbers []int
+	entries, err := os.ReadDir("./puzzles/" + path)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == "index.html" {
+			continue
+		}
+		if match := partPattern.FindStringSubmatch(e.Name()); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			partNumbers = append(partNumbers, number)
+		} else {
+			files = append(files, e.Name())
+		}
+	}
+	slices.Sort(partNumbers)
+	for i, number := range partNumbers {
+		if number != i+1 {
+			return nil, fmt.Errorf("no part%d.html", i+1)
+		}
+	}
+	if len(partNumbers) == 0 {
+		if err := checkAnswers(meta); err != nil {
+			return nil, err
+		}
+	} else if len(meta.Answers) > 0 || len(meta.SubAnswers) > 0 {
+		return nil, errors.New("puzzles with parts take their answers from each part, not index.html")
+	}
+	for i, tag := range meta.Tags {
+		meta.Tags[i] = slugify(tag)
+		if meta.Tags[i] == "" {
+			return nil, fmt.Errorf("puzzle tag %q must contain letters or numbers", tag)
+		}
+	}
+	if meta.Slug != slugify(meta.Slug) {
+		return nil, fmt.Errorf("puzzle slug %q must only contain lowercase letters, numbers and hyphens", meta.Slug)
+	}
+	id := meta.Slug
+	if id == "" {
+		id = slugify(meta.Title)
+	}
+	if id == "" {
+		id = path
+	}
+	// A puzzle's own slug, or the same alias listed twice, isn't a collision
+	var aliases []string
+	for _, alias := range append(slices.Clone(meta.Aliases), path) {
+		if alias != id && !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	puzzle := &Puzzle{
+		ID:            id,
+		Dir:           path,
+		Aliases:       aliases,
+		Metadata:      *meta,
+		Files:         files,
+		Checksums:     make(map[string]string),
+		PageChecksums: make(map[string]string),
+	}
+	for _, file := range files {
+		puzzle.Checksums[file], err = fileHash("./puzzles/" + path + "/" + file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pages := []string{"index.html"}
+	for _, number := range partNumbers {
+		pages = append(pages, fmt.Sprintf("part%d.html", number))
+	}
+	for _, page := range pages {
+		puzzle.PageChecksums[page], err = fileHash("./puzzles/" + path + "/" + page)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkMedia(puzzle); err != nil {
+		return nil, err
+	}
+	if puzzle.Scripts, err = puzzleAssets(puzzle, meta.Scripts); err != nil {
+		return nil, err
+	}
+	if puzzle.Styles, err = puzzleAssets(puzzle, meta.Styles); err != nil {
+		return nil, err
+	}
+	puzzle.Content, err = expandShortcodes(puzzle, meta, content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to expand shortcodes in index.html: %w", err)
+	}
+	for _, number := range partNumbers {
+		name := fmt.Sprintf("part%d.html", number)
+		partMeta, partContent, err := readPage(path + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAnswers(partMeta); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(partMeta.SubAnswers) > 0 {
+			return nil, fmt.Errorf("%s: puzzle parts can't have sub-answers", name)
+		}
+		if partMeta.Type == "upload" {
+			return nil, fmt.Errorf("%s: puzzle parts can't be uploads", name)
+		}
+		partContent, err = expandShortcodes(puzzle, partMeta, partContent)
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand shortcodes in %s: %w", name, err)
+		}
+		puzzle.Parts = append(puzzle.Parts, Part{
+			Metadata: *partMeta,
+			Content:  partContent,
+		})
+	}
+	return puzzle, nil
+}
+
+var partPattern = regexp.MustCompile(`^part([1-9][0-9]*)\.html$`)
+
+// readPage reads an HTML file with frontmatter from the puzzles directory.
+func readPage(path string) (*Puzzlemeta, string, error) {
+	pageBytes, err := os.ReadFile("./puzzles/" + path)
 	if errors.Is(err, os.ErrNotExist) {
-		log.Fatal("puzzles/" + path + "/index.html - not found")
+		return nil, "", errors.New("puzzles/" + path + " - not found")
 	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, "", err
 	}
-	frontmatterBytes, contentBytes, err := splitFrontMatter(indexBytes)
+	frontmatterBytes, contentBytes, err := splitFrontMatter(pageBytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, "", fmt.Errorf("puzzles/%s: %w", path, err)
 	}
 	meta := &Puzzlemeta{}
 	err = yaml.Unmarshal(frontmatterBytes, meta)
 	if err != nil {
-		log.Println("Unable to unmarshall frontmatter")
-		log.Fatal(err)
+		return nil, "", fmt.Errorf("unable to unmarshall frontmatter in puzzles/%s: %w", path, err)
 	}
-	if meta.Title == "" {
-		log.Fatal("Puzzle needs a title")
+	return meta, string(contentBytes), nil
+}
+
+// checkAnswers makes sure a puzzle (or part) has valid answers to check
+// guesses against. Whitespace in answers is normalised the same way as in
+// guesses, so an answer written with stray spaces can still be matched.
+func checkAnswers(meta *Puzzlemeta) error {
+	for i := range meta.Answers {
+		meta.Answers[i].Answer = canonicalGuess(meta.Answers[i].Answer)
 	}
-	if len(meta.Answers) == 0 {
-		log.Fatal("Puzzle needs at least one answer")
+	for _, group := range meta.SubAnswers {
+		for i := range group {
+			group[i] = canonicalGuess(group[i])
+		}
 	}
-	var files []string
-	entries, err := os.ReadDir("./puzzles/" + path)
-	if errors.Is(err, os.ErrNotExist) {
-		log.Fatal("Puzzles folder must exist")
+	if meta.Type == "upload" {
+		if len(meta.Answers) > 0 || len(meta.SubAnswers) > 0 {
+			return errors.New("upload puzzles are checked by organisers, and can't have answers")
+		}
+		return nil
 	}
-	if err != nil {
-		log.Fatal(err)
+	if len(meta.Answers) == 0 && len(meta.SubAnswers) == 0 {
+		return errors.New("puzzle needs at least one answer")
 	}
-	for _, e := range entries {
-		if !e.IsDir() && e.Name() != "index.html" {
-			files = append(files, e.Name())
+	for _, answer := range meta.Answers {
+		if answer.Answer == "" {
+			return errors.New("puzzle answers can't be blank")
+		}
+	}
+	switch meta.Type {
+	case "", "text":
+	case "numeric":
+		if _, ok := units[meta.Units]; meta.Units != "" && !ok {
+			return fmt.Errorf("puzzle has unknown units %q", meta.Units)
+		}
+		for _, answer := range meta.Answers {
+			if _, err := parseQuantity(answer.Answer, meta.Units); err != nil {
+				return fmt.Errorf("puzzle has invalid numeric answer: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("puzzle has unknown type %q", meta.Type)
+	}
+	for _, group := range meta.SubAnswers {
+		if len(group) == 0 || slices.Contains(group, "") {
+			return errors.New("puzzle sub-answers can't be blank")
+		}
+	}
+	for _, response := range meta.Responses {
+		if len(response.Guesses) == 0 || slices.Contains(response.Guesses, "") || response.Message == "" {
+			return errors.New("puzzle responses need a guess and a message")
 		}
 	}
-	return &Puzzle{
-		ID:       path,
-		Metadata: *meta,
-		Content:  string(contentBytes),
-		Files:    files,
+	return nil
+}
+
+// slugify turns a puzzle title into a lowercase, hyphen-separated slug
+// suitable for use in URLs.
+func slugify(title string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			slug.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
 	}
+	return slug.String()
 }
 
 func splitFrontMatter(file []byte) ([]byte, []byte, error) {
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchmarkPuzzles is how many puzzles the generated test hunts have, to
+// show how things scale for large hunts.
+const benchmarkPuzzles = 500
+
+// testHunt is a generated hunt in a temporary folder, which the test is run
+// from.
+type testHunt struct {
+	config *Config
+	store  *PuzzleStore
+	mux    *http.ServeMux
+}
+
+// newTestHunt writes count puzzles and the default layout to a temporary
+// folder, changes to it, and loads the puzzles. Puzzle i has the ID
+// puzzle-i, the alias old-i and the answer answer-i.
+func newTestHunt(tb testing.TB, count int) *testHunt {
+	tb.Helper()
+	dir := tb.TempDir()
+	err := fs.WalkDir(defaultLayout, "layout", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contents, err := defaultLayout.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeTestFile(filepath.Join(dir, path), string(contents))
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := writeTestFile(filepath.Join(dir, "puzzles", "index.html"), "<h1>Test hunt</h1>"); err != nil {
+		tb.Fatal(err)
+	}
+	for i := range count {
+		puzzleDir := filepath.Join(dir, "puzzles", fmt.Sprintf("dir-%d", i))
+		page := fmt.Sprintf("<!--\ntitle: Puzzle %d\nslug: puzzle-%d\naliases: [old-%d]\nanswers: [answer-%d]\n-->\n<p>Puzzle number %d.</p>\n", i, i, i, i, i)
+		if err := writeTestFile(filepath.Join(puzzleDir, "index.html"), page); err != nil {
+			tb.Fatal(err)
+		}
+		if err := writeTestFile(filepath.Join(puzzleDir, "grid.txt"), strings.Repeat("x", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	chdir(tb, dir)
+	foundPuzzles, err := getPuzzles()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	hunt := &testHunt{
+		config: &Config{
+			Features: newFeatureFlags(),
+			Uploads:  "uploads",
+			Activity: ActivityConfig{Size: defaultActivitySize},
+			Secret:   "test secret",
+		},
+		store: newPuzzleStore(foundPuzzles),
+		mux:   http.NewServeMux(),
+	}
+	hub := newEventHub()
+	submissions := loadSubmissions(hunt.config)
+	hunt.mux.HandleFunc("GET /{$}", serveIndex(hunt.config, hunt.store))
+	hunt.mux.HandleFunc("GET /puzzles/{id}/", servePuzzle(hunt.config, hunt.store, submissions, hub))
+	hunt.mux.HandleFunc("GET /puzzles/{id}/{file}", servePuzzleFile(hunt.config, hunt.store))
+	hunt.mux.HandleFunc("POST /guess", handleGuess(hunt.config, hunt.store, hub, newWrongGuesses()))
+	return hunt
+}
+
+func writeTestFile(path string, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(contents), 0644)
+}
+
+// chdir changes to dir for the rest of the test, as puzzles and layouts are
+// read relative to the working directory.
+func chdir(tb testing.TB, dir string) {
+	tb.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = os.Chdir(previous)
+	})
+}
+
+// get makes a request to the hunt and returns the response.
+func (h *testHunt) get(path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+// guess submits a guess to the hunt and returns the response.
+func (h *testHunt) guess(puzzle string, guess string) *httptest.ResponseRecorder {
+	form := url.Values{"puzzle": {puzzle}, "guess": {guess}}
+	request := httptest.NewRequest(http.MethodPost, "/guess", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	h.mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestServePuzzle(t *testing.T) {
+	hunt := newTestHunt(t, 3)
+	if response := hunt.get("/puzzles/puzzle-1/"); response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "Puzzle number 1.") {
+		t.Errorf("puzzle page: got %d %q", response.Code, response.Body.String())
+	}
+	for _, alias := range []string{"old-1", "dir-1"} {
+		response := hunt.get("/puzzles/" + alias + "/")
+		if response.Code != http.StatusMovedPermanently || response.Header().Get("Location") != "/puzzles/puzzle-1/" {
+			t.Errorf("alias %s: got %d to %q", alias, response.Code, response.Header().Get("Location"))
+		}
+	}
+	if response := hunt.get("/puzzles/missing/"); response.Code != http.StatusNotFound {
+		t.Errorf("missing puzzle: got %d", response.Code)
+	}
+	if response := hunt.get("/puzzles/puzzle-2/grid.txt"); response.Code != http.StatusOK || response.Body.String() != "xx" {
+		t.Errorf("puzzle file: got %d %q", response.Code, response.Body.String())
+	}
+}
+
+func TestGuess(t *testing.T) {
+	hunt := newTestHunt(t, 3)
+	if response := hunt.guess("puzzle-1", "answer-1"); response.Code != http.StatusOK {
+		t.Errorf("correct guess: got %d", response.Code)
+	}
+	if response := hunt.guess("puzzle-1", "answer-2"); response.Code != http.StatusNotFound {
+		t.Errorf("wrong guess: got %d", response.Code)
+	}
+	if response := hunt.guess("missing", "answer-1"); response.Code != http.StatusBadRequest {
+		t.Errorf("missing puzzle: got %d", response.Code)
+	}
+}
+
+func TestBeforeStart(t *testing.T) {
+	hunt := newTestHunt(t, 3)
+	hunt.config.Start = time.Now().Add(time.Hour)
+	hunt.config.ListPuzzles = true
+	for _, path := range []string{"/puzzles/puzzle-1/", "/puzzles/old-1/", "/puzzles/puzzle-1/grid.txt"} {
+		if response := hunt.get(path); response.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d", path, response.Code)
+		}
+	}
+	if response := hunt.guess("puzzle-1", "answer-1"); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("guess: got %d", response.Code)
+	}
+	if response := hunt.get("/"); response.Code != http.StatusOK || strings.Contains(response.Body.String(), "puzzle-1") {
+		t.Errorf("index: got %d %q", response.Code, response.Body.String())
+	}
+}
+
+func TestCookie(t *testing.T) {
+	config := &Config{Secret: "test secret"}
+	sealed, err := sealCookie(config, []byte("progress"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := openCookie(config, sealed); err != nil || string(plaintext) != "progress" {
+		t.Errorf("round trip: got %q, %v", plaintext, err)
+	}
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	if _, err := openCookie(config, string(tampered)); err == nil {
+		t.Error("opened a tampered cookie")
+	}
+	if _, err := openCookie(&Config{Secret: "another secret"}, sealed); err == nil {
+		t.Error("opened a cookie with the wrong secret")
+	}
+	if _, err := openCookie(config, "short"); err == nil {
+		t.Error("opened a cookie that's too short")
+	}
+}
+
+func TestSaveProgress(t *testing.T) {
+	config := &Config{Progress: "cookie", Secret: "test secret"}
+	progress := &Progress{Team: "team"}
+	for i := range benchmarkPuzzles {
+		progress.Solve(fmt.Sprintf("puzzle-%d", i))
+	}
+	recorder := httptest.NewRecorder()
+	saveProgress(config, recorder, httptest.NewRequest(http.MethodGet, "/", nil), progress)
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || len(cookies[0].Value) > maxCookieSize {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.AddCookie(cookies[0])
+	if loaded := loadProgress(config, request); loaded.Team != "team" || len(loaded.Solved) != benchmarkPuzzles {
+		t.Errorf("got %d solves for team %q", len(loaded.Solved), loaded.Team)
+	}
+
+	// Hashes don't compress, so these are far too long for a cookie
+	progress.Solved = nil
+	for i := range 200 {
+		progress.Solve(fmt.Sprintf("%x", sha256.Sum256([]byte{byte(i)})))
+	}
+	recorder = httptest.NewRecorder()
+	saveProgress(config, recorder, httptest.NewRequest(http.MethodGet, "/", nil), progress)
+	if cookies := recorder.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("saved a cookie of %d bytes", len(cookies[0].Value))
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	hunt := newTestHunt(b, benchmarkPuzzles)
+	foundPuzzles := hunt.store.Load()
+	b.Run("id", func(b *testing.B) {
+		for i := range b.N {
+			if foundPuzzles.Lookup(fmt.Sprintf("puzzle-%d", i%benchmarkPuzzles)) == nil {
+				b.Fatal("puzzle not found")
+			}
+		}
+	})
+	b.Run("alias", func(b *testing.B) {
+		for i := range b.N {
+			if foundPuzzles.LookupAlias(fmt.Sprintf("old-%d", i%benchmarkPuzzles)) == nil {
+				b.Fatal("alias not found")
+			}
+		}
+	})
+	b.Run("missing", func(b *testing.B) {
+		for range b.N {
+			if foundPuzzles.Lookup("missing") != nil {
+				b.Fatal("found a puzzle that doesn't exist")
+			}
+		}
+	})
+}
+
+func BenchmarkServePuzzle(b *testing.B) {
+	hunt := newTestHunt(b, benchmarkPuzzles)
+	b.Run("page", func(b *testing.B) {
+		for i := range b.N {
+			if response := hunt.get(fmt.Sprintf("/puzzles/puzzle-%d/", i%benchmarkPuzzles)); response.Code != http.StatusOK {
+				b.Fatalf("got %d", response.Code)
+			}
+		}
+	})
+	b.Run("alias", func(b *testing.B) {
+		for i := range b.N {
+			if response := hunt.get(fmt.Sprintf("/puzzles/old-%d/", i%benchmarkPuzzles)); response.Code != http.StatusMovedPermanently {
+				b.Fatalf("got %d", response.Code)
+			}
+		}
+	})
+	b.Run("file", func(b *testing.B) {
+		for i := range b.N {
+			if response := hunt.get(fmt.Sprintf("/puzzles/puzzle-%d/grid.txt", i%benchmarkPuzzles)); response.Code != http.StatusOK {
+				b.Fatalf("got %d", response.Code)
+			}
+		}
+	})
+}
+
+func BenchmarkGuess(b *testing.B) {
+	hunt := newTestHunt(b, benchmarkPuzzles)
+	b.Run("correct", func(b *testing.B) {
+		for i := range b.N {
+			n := i % benchmarkPuzzles
+			if response := hunt.guess(fmt.Sprintf("puzzle-%d", n), fmt.Sprintf("answer-%d", n)); response.Code != http.StatusOK {
+				b.Fatalf("got %d", response.Code)
+			}
+		}
+	})
+	b.Run("wrong", func(b *testing.B) {
+		for i := range b.N {
+			if response := hunt.guess(fmt.Sprintf("puzzle-%d", i%benchmarkPuzzles), "wrong"); response.Code != http.StatusNotFound {
+				b.Fatalf("got %d", response.Code)
+			}
+		}
+	})
+}
+
+func TestWrongAnswerResponse(t *testing.T) {
+	meta := Puzzlemeta{Responses: []Response{{Guesses: []string{"Old Lighthouse"}, Message: "Last year's"}}}
+	for _, guess := range []string{"old lighthouse", "OLD-LIGHTHOUSE", "oldlighthouse!"} {
+		if response := meta.wrongAnswerResponse(guess); response == nil || response.Message != "Last year's" {
+			t.Errorf("%q: got %v", guess, response)
+		}
+	}
+	if response := meta.wrongAnswerResponse("new lighthouse"); response != nil {
+		t.Errorf("new lighthouse: got %v", response)
+	}
+}
+
+func TestCheckAnswersWhitespace(t *testing.T) {
+	meta := &Puzzlemeta{
+		Answers:    []Answer{{Answer: " old  lighthouse "}},
+		SubAnswers: []AnswerGroup{{"north\tstar", " beacon"}},
+	}
+	if err := checkAnswers(meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.matchAnswer(canonicalGuess("old lighthouse ")) != 0 {
+		t.Errorf("answer with stray spaces: got %q", meta.Answers[0].Answer)
+	}
+	if group := meta.SubAnswers[0]; group[0] != "north star" || group[1] != "beacon" {
+		t.Errorf("sub-answers with stray spaces: got %q", group)
+	}
+	if err := checkAnswers(&Puzzlemeta{Answers: []Answer{{Answer: "  "}}}); err == nil {
+		t.Error("accepted an answer that's only spaces")
+	}
+}
+
+func TestAccessibilityReturn(t *testing.T) {
+	for target, want := range map[string]string{
+		"/puzzles/first/":  "/puzzles/first/",
+		"//evil.com":       "/",
+		`/\evil.com`:       "/",
+		"https://evil.com": "/",
+		"puzzles/first/":   "/",
+	} {
+		form := url.Values{"enabled": {"true"}, "return": {target}}
+		request := httptest.NewRequest(http.MethodPost, "/accessibility", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handleAccessibility(recorder, request)
+		if location := recorder.Header().Get("Location"); location != want {
+			t.Errorf("%q: redirected to %q", target, location)
+		}
+	}
+}
+
+func TestActiveTeamsChart(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+	events := []Event{
+		{Event: "guess", Team: "a", Time: now.Add(-2 * time.Hour)},
+		{Event: "guess", Team: "a", Time: now.Add(-2 * time.Hour)},
+		{Event: "solve", Team: "b", Time: now.Add(-2 * time.Hour)},
+		{Event: "guess", Team: "a", Time: now},
+		{Event: "announcement", Time: now},
+	}
+	chart := dashboardCharts(events, now)[2]
+	if bars := chart.Bars; bars[21].Label != "10:00: 2" || bars[23].Label != "12:00: 1" || bars[22].Label != "11:00: 0" {
+		t.Errorf("got bars %v", bars[21:])
+	}
+}
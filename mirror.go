@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// mirrorRetryDelay is how long a mirror waits before reconnecting to the
+// primary after losing its connection.
+const mirrorRetryDelay = 5 * time.Second
+
+// syncMirror keeps the activity feed in step with the primary's, by
+// fetching its current items and then following its stream of new ones. If
+// the connection drops it reconnects and fetches everything again, so
+// nothing missed in between is lost. It never returns.
+func syncMirror(config *Config, feed *ActivityFeed) {
+	for {
+		if err := followPrimary(config.Mirror, feed); err != nil {
+			log.Printf("Lost connection to primary %s: %v", config.Mirror, err)
+		}
+		time.Sleep(mirrorRetryDelay)
+	}
+}
+
+func followPrimary(primary string, feed *ActivityFeed) error {
+	stream, err := http.Get(primary + "/api/activity/stream")
+	if err != nil {
+		return err
+	}
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK {
+		return fmt.Errorf("activity stream returned %s", stream.Status)
+	}
+	// Fetch the current items only once the stream is open, so anything
+	// that happens in between comes through the stream.
+	response, err := http.Get(primary + "/api/activity")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("activity feed returned %s", response.Status)
+	}
+	var items []ActivityItem
+	if err := json.NewDecoder(response.Body).Decode(&items); err != nil {
+		return err
+	}
+	feed.Replace(items)
+	log.Printf("Mirroring %d activity items from %s", len(items), primary)
+	var latest time.Time
+	if len(items) > 0 {
+		latest = items[0].Time
+	}
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var item ActivityItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			log.Printf("Invalid activity item from primary: %v", err)
+			continue
+		}
+		// Items from just before the feed was fetched are already in it
+		if item.Time.After(latest) {
+			feed.Add(item)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("activity stream ended")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type unit struct {
+	dimension string
+	factor    float64
+}
+
+// units maps accepted unit names to their dimension and size relative to the
+// base unit for that dimension.
+var units = map[string]unit{}
+
+func init() {
+	for _, u := range []struct {
+		names     []string
+		dimension string
+		factor    float64
+	}{
+		{[]string{"mm", "millimetre", "millimetres", "millimeter", "millimeters"}, "length", 0.001},
+		{[]string{"cm", "centimetre", "centimetres", "centimeter", "centimeters"}, "length", 0.01},
+		{[]string{"m", "metre", "metres", "meter", "meters"}, "length", 1},
+		{[]string{"km", "kilometre", "kilometres", "kilometer", "kilometers"}, "length", 1000},
+		{[]string{"in", "inch", "inches"}, "length", 0.0254},
+		{[]string{"ft", "foot", "feet"}, "length", 0.3048},
+		{[]string{"yd", "yard", "yards"}, "length", 0.9144},
+		{[]string{"mi", "mile", "miles"}, "length", 1609.344},
+		{[]string{"nmi", "nautical mile", "nautical miles"}, "length", 1852},
+		{[]string{"mg", "milligram", "milligrams"}, "mass", 0.000001},
+		{[]string{"g", "gram", "grams"}, "mass", 0.001},
+		{[]string{"kg", "kilogram", "kilograms"}, "mass", 1},
+		{[]string{"t", "tonne", "tonnes"}, "mass", 1000},
+		{[]string{"oz", "ounce", "ounces"}, "mass", 0.028349523125},
+		{[]string{"lb", "lbs", "pound", "pounds"}, "mass", 0.45359237},
+		{[]string{"ms", "millisecond", "milliseconds"}, "time", 0.001},
+		{[]string{"s", "sec", "secs", "second", "seconds"}, "time", 1},
+		{[]string{"min", "mins", "minute", "minutes"}, "time", 60},
+		{[]string{"h", "hr", "hrs", "hour", "hours"}, "time", 3600},
+		{[]string{"d", "day", "days"}, "time", 86400},
+	} {
+		for _, name := range u.names {
+			units[name] = unit{dimension: u.dimension, factor: u.factor}
+		}
+	}
+}
+
+var quantityPattern = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(.*)$`)
+
+// parseQuantity parses a number with an optional unit, returning its value in
+// defaultUnit. Numbers without a unit are assumed to be in defaultUnit already.
+func parseQuantity(text string, defaultUnit string) (float64, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), ",", "")
+	match := quantityPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, fmt.Errorf("%q is not a number", text)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	unitName := strings.ToLower(strings.TrimSuffix(match[2], "."))
+	if unitName == "" || unitName == defaultUnit {
+		return value, nil
+	}
+	from, ok := units[unitName]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", match[2])
+	}
+	to, ok := units[defaultUnit]
+	if !ok || to.dimension != from.dimension {
+		return 0, fmt.Errorf("can't convert %q to %q", match[2], defaultUnit)
+	}
+	return value * from.factor / to.factor, nil
+}
+
+// matchNumeric returns the index of the answer within tolerance of the guess,
+// or -1 if there isn't one.
+func matchNumeric(meta Puzzlemeta, guess string) int {
+	value, err := parseQuantity(guess, meta.Units)
+	if err != nil {
+		return -1
+	}
+	return slices.IndexFunc(meta.Answers, func(answer Answer) bool {
+		expected, err := parseQuantity(answer.Answer, meta.Units)
+		// Allow for a little floating point error from unit conversions
+		return err == nil && math.Abs(expected-value) <= meta.Tolerance+1e-9*math.Abs(expected)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// landingPages are the optional pages shown instead of puzzles/index.html
+// before the hunt starts and after it ends, keyed by phase.
+var landingPages = map[string]string{
+	"before": "./puzzles/before.html",
+	"after":  "./puzzles/after.html",
+}
+
+// huntPhase returns whether the hunt is yet to start ("before"), is
+// "running", or is over ("after"), going by the configured start and end.
+func huntPhase(config *Config, now time.Time) string {
+	if !config.Start.IsZero() && now.Before(config.Start) {
+		return "before"
+	}
+	if !config.End.IsZero() && !now.Before(config.End) {
+		return "after"
+	}
+	return "running"
+}
+
+// puzzlesOpen returns whether teams can see and guess puzzles, which they
+// can't before the hunt starts.
+func puzzlesOpen(config *Config) bool {
+	return huntPhase(config, time.Now()) != "before"
+}
+
+// readLandingPages reads whichever of the landing pages exist.
+func readLandingPages() (map[string]string, error) {
+	pages := make(map[string]string)
+	for phase, path := range landingPages {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pages[phase] = string(content)
+	}
+	return pages, nil
+}
+
+// landingPage returns the content for the index page in the current phase of
+// the hunt, and whether the puzzles should be listed on it. They're not listed
+// before the hunt starts.
+func landingPage(config *Config, foundPuzzles *Puzzles) (string, bool) {
+	phase := huntPhase(config, time.Now())
+	content, ok := foundPuzzles.Landing[phase]
+	if !ok {
+		content = foundPuzzles.Index
+	}
+	return content, puzzlesOpen(config)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const progressCookie = "poozles_progress"
+
+// maxCookieSize is the longest a progress cookie's value can be. Browsers
+// throw away cookies over 4096 bytes including the name and attributes,
+// which would lose the team's progress entirely.
+const maxCookieSize = 4000
+
+// Progress records which puzzles a team has solved, which sub-answers they've
+// found, how far they've got through multi-stage puzzles, and which files
+// they've submitted.
+type Progress struct {
+	// Team is a random ID given to the team when their progress is first
+	// saved, so events from the same team can be told apart from others.
+	Team       string           `json:"team,omitempty"`
+	Solved     []string         `json:"solved,omitempty"`
+	SubAnswers map[string][]int `json:"subanswers,omitempty"`
+	Parts      map[string]int   `json:"parts,omitempty"`
+	// Submissions are the IDs of the latest files uploaded for puzzles that
+	// are checked by organisers.
+	Submissions map[string]string `json:"submissions,omitempty"`
+}
+
+// IsSolved returns whether the puzzle with the given ID has been solved.
+func (p *Progress) IsSolved(id string) bool {
+	return slices.Contains(p.Solved, id)
+}
+
+// PartsSolved returns how many parts of a multi-stage puzzle have been solved.
+func (p *Progress) PartsSolved(id string) int {
+	return p.Parts[id]
+}
+
+// SolvePart records that the given part of a multi-stage puzzle, and so all
+// of the parts before it, have been solved.
+func (p *Progress) SolvePart(id string, part int) {
+	if p.Parts == nil {
+		p.Parts = make(map[string]int)
+	}
+	p.Parts[id] = max(p.Parts[id], part)
+}
+
+// Solve marks the puzzle with the given ID as solved.
+func (p *Progress) Solve(id string) {
+	if !p.IsSolved(id) {
+		p.Solved = append(p.Solved, id)
+	}
+}
+
+// Submit records the latest file uploaded for a puzzle.
+func (p *Progress) Submit(id string, submission string) {
+	if p.Submissions == nil {
+		p.Submissions = make(map[string]string)
+	}
+	p.Submissions[id] = submission
+}
+
+// FindSubAnswer records that the given sub-answer has been found for a
+// puzzle, and returns how many of its sub-answers have been found in total.
+func (p *Progress) FindSubAnswer(id string, index int) int {
+	if p.SubAnswers == nil {
+		p.SubAnswers = make(map[string][]int)
+	}
+	if !slices.Contains(p.SubAnswers[id], index) {
+		p.SubAnswers[id] = append(p.SubAnswers[id], index)
+	}
+	return len(p.SubAnswers[id])
+}
+
+// loadProgress returns the progress stored in the request's cookie. If
+// progress isn't being tracked it returns empty progress, and if the cookie
+// is missing or invalid empty progress with a new team ID.
+func loadProgress(config *Config, request *http.Request) *Progress {
+	progress := &Progress{}
+	if config.Progress != "cookie" {
+		return progress
+	}
+	if cookie, err := request.Cookie(progressCookie); err == nil {
+		if plaintext, err := openCookie(config, cookie.Value); err == nil {
+			_ = json.Unmarshal(decompress(plaintext), progress)
+		}
+	}
+	if progress.Team == "" {
+		team := make([]byte, 8)
+		_, _ = rand.Read(team)
+		progress.Team = hex.EncodeToString(team)
+	}
+	return progress
+}
+
+// saveProgress stores progress in a cookie on the response, if progress is
+// being tracked. If it's grown too big for a cookie it's not saved, leaving
+// the team's previous cookie as it was, rather than having the browser drop
+// it.
+func saveProgress(config *Config, writer http.ResponseWriter, request *http.Request, progress *Progress) {
+	if config.Progress != "cookie" {
+		return
+	}
+	plaintext, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+	value, err := sealCookie(config, compress(plaintext))
+	if err != nil {
+		return
+	}
+	if len(value) > maxCookieSize {
+		log.Printf("WARNING: progress for team %s is too big for a cookie (%d bytes), so it wasn't saved", progress.Team, len(value))
+		return
+	}
+	http.SetCookie(writer, &http.Cookie{
+		Name:     progressCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// compressedProgress marks progress that's been compressed.
+const compressedProgress = 1
+
+// compress deflates progress before it's sealed, as the lists of puzzle IDs
+// in it compress well.
+func compress(plaintext []byte) []byte {
+	compressed := bytes.NewBuffer([]byte{compressedProgress})
+	writer, _ := flate.NewWriter(compressed, flate.BestCompression)
+	_, _ = writer.Write(plaintext)
+	_ = writer.Close()
+	return compressed.Bytes()
+}
+
+// decompress inflates progress from a cookie. Cookies from before progress
+// was compressed are plain JSON, so are returned as they are.
+func decompress(plaintext []byte) []byte {
+	if len(plaintext) == 0 || plaintext[0] != compressedProgress {
+		return plaintext
+	}
+	decompressed, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(plaintext[1:])), 1<<20))
+	if err != nil {
+		return nil
+	}
+	return decompressed
+}
+
+// cookieCipher returns an AEAD cipher keyed from the configured secret, so
+// cookie contents can't be read or tampered with by players.
+func cookieCipher(config *Config) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(config.Secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealCookie(config *Config, plaintext []byte) (string, error) {
+	aead, err := cookieCipher(config)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(progressCookie))), nil
+}
+
+func openCookie(config *Config, value string) ([]byte, error) {
+	aead, err := cookieCipher(config)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("cookie too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(progressCookie))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// robotsHeader marks every response as not to be indexed, unless the config
+// allows it. This covers puzzle files as well as pages.
+func robotsHeader(config *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !config.AllowIndexing {
+			writer.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func serveRobots(config *Config) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !config.AllowIndexing {
+			fmt.Fprint(writer, "User-agent: *\nDisallow: /\n")
+			return
+		}
+		fmt.Fprint(writer, "User-agent: *\nAllow: /\n")
+		if config.Sitemap {
+			fmt.Fprintf(writer, "\nSitemap: %s/sitemap.xml\n", config.BaseURL)
+		}
+	}
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+func serveSitemap(config *Config, store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		urlSet := sitemapURLSet{
+			XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
+			URLs:  []sitemapURL{{Loc: config.BaseURL + "/"}},
+		}
+		listed := foundPuzzles.Listed
+		if !puzzlesOpen(config) {
+			listed = nil
+		}
+		for _, puzzle := range listed {
+			urlSet.URLs = append(urlSet.URLs, sitemapURL{
+				Loc: config.BaseURL + "/puzzles/" + url.PathEscape(puzzle.ID) + "/",
+			})
+		}
+		writer.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(writer, xml.Header)
+		err := xml.NewEncoder(writer).Encode(urlSet)
+		if err != nil {
+			fmt.Println("Error writing sitemap")
+			fmt.Println(err)
+		}
+	}
+}
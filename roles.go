@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+)
+
+// roles maps each organiser role to what it's allowed to do on top of
+// viewing the admin page: "features" to turn features on and off, "content"
+// to reload and roll back puzzles, "hints" to make announcements, respond to
+// wrong guesses and review submissions, "export" to download the data, and
+// "blocks" to block and unblock clients.
+var roles = map[string][]string{
+	"superadmin":      {"features", "content", "hints", "export", "blocks"},
+	"content-editor":  {"content", "export"},
+	"hint-giver":      {"hints"},
+	"spectator-admin": {"export"},
+}
+
+// Organiser is someone who can use the admin pages, limited by their role.
+type Organiser struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	Role     string `yaml:"role"`
+}
+
+// adminRole returns the role of the organiser making a request, from its
+// basic auth credentials. The admin password works with any username, and
+// gives the superadmin role.
+func adminRole(config *Config, request *http.Request) (string, bool) {
+	name, password, ok := request.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	for _, organiser := range config.Organisers {
+		if organiser.Name == name {
+			if subtle.ConstantTimeCompare([]byte(password), []byte(organiser.Password)) == 1 {
+				return organiser.Role, true
+			}
+			return "", false
+		}
+	}
+	if config.AdminPassword != "" && subtle.ConstantTimeCompare([]byte(password), []byte(config.AdminPassword)) == 1 {
+		return "superadmin", true
+	}
+	return "", false
+}
+
+// permissions returns the set of things a role can do, for the admin page to
+// only show what the organiser can use.
+func permissions(role string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, permission := range roles[role] {
+		allowed[permission] = true
+	}
+	return allowed
+}
+
+func hasPermission(role string, permission string) bool {
+	return permission == "" || slices.Contains(roles[role], permission)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultLayout is the layout folder poozles was built with, used as the
+// starting theme for new hunts.
+//
+//go:embed layout
+var defaultLayout embed.FS
+
+const exampleIndex = `<h1>My puzzle hunt</h1>
+<p>Welcome! Here are the puzzles:</p>
+`
+
+const exampleConfig = `# See the README for every setting.
+
+# List every puzzle on the index page, below puzzles/index.html.
+list_puzzles: true
+# Track which puzzles each team has solved in an encrypted cookie.
+progress: cookie
+# Password for the admin pages at /admin/ (any username).
+# admin_password: a long random password
+# Key used to sign and encrypt cookies. Set this so cookies keep working when
+# the server restarts.
+# secret: some long random string
+`
+
+const examplePuzzle = `<!--
+title: %s
+answers: ["change me"]
+hints: ["A hint for teams who are stuck"]
+-->
+<p>The puzzle goes here. Files in this folder can be linked to with
+{{"{{"}}file "name.png"}}.</p>
+{{hintbox}}
+`
+
+// newHunt creates the folders and files for a new hunt in dir: the layout,
+// an index page, an example puzzle and a config.yml. It won't overwrite
+// anything that already exists.
+func newHunt(dir string) error {
+	err := fs.WalkDir(defaultLayout, "layout", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		contents, err := defaultLayout.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return createFile(filepath.Join(dir, path), string(contents))
+	})
+	if err != nil {
+		return err
+	}
+	if err := createFile(filepath.Join(dir, "puzzles", "index.html"), exampleIndex); err != nil {
+		return err
+	}
+	if err := createFile(filepath.Join(dir, "config.yml"), exampleConfig); err != nil {
+		return err
+	}
+	return newPuzzle(dir, "example")
+}
+
+// newPuzzle creates a folder with an example index.html for a new puzzle in
+// the hunt in dir.
+func newPuzzle(dir string, id string) error {
+	if id == "" || id != slugify(id) {
+		return fmt.Errorf("puzzle ID %q must only contain lowercase letters, numbers and hyphens", id)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "puzzles")); err != nil {
+		return errors.New("no puzzles folder found, run this from the hunt's folder")
+	}
+	title := strings.ReplaceAll(id, "-", " ")
+	title = strings.ToUpper(title[:1]) + title[1:]
+	return createFile(filepath.Join(dir, "puzzles", id, "index.html"), fmt.Sprintf(examplePuzzle, title))
+}
+
+// createFile writes a new file, creating any folders it needs, and fails if
+// the file already exists.
+func createFile(path string, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(contents); err != nil {
+		_ = file.Close()
+		return err
+	}
+	fmt.Println("Created", path)
+	return file.Close()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetContext is roughly how many bytes of text to show either side of a
+// search match.
+const snippetContext = 60
+
+var (
+	scriptPattern = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	tagPattern    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// searchEntry holds the searchable text of a puzzle: its title, its content,
+// and then the content of each of its parts.
+type searchEntry struct {
+	puzzle   *Puzzle
+	sections []string
+	lower    []string
+}
+
+// SearchResult is a puzzle that matched a search, with an extract of the
+// text that matched.
+type SearchResult struct {
+	Puzzle  PuzzleLink
+	Snippet string
+}
+
+func newSearchEntry(puzzle *Puzzle) searchEntry {
+	entry := searchEntry{
+		puzzle:   puzzle,
+		sections: []string{puzzle.Metadata.Title, plainText(puzzle.Content)},
+	}
+	for _, part := range puzzle.Parts {
+		entry.sections = append(entry.sections, plainText(part.Content))
+	}
+	for _, section := range entry.sections {
+		entry.lower = append(entry.lower, strings.ToLower(section))
+	}
+	return entry
+}
+
+// plainText strips the markup from HTML content, leaving just its text.
+func plainText(content string) string {
+	content = scriptPattern.ReplaceAllString(content, " ")
+	content = stripSpoilers(content)
+	content = hintboxPattern.ReplaceAllString(content, " ")
+	content = conditionPattern.ReplaceAllString(content, " ")
+	content = tagPattern.ReplaceAllString(content, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(content)), " ")
+}
+
+// stripSpoilers removes everything inside spoiler shortcodes, including any
+// spoilers nested inside them.
+func stripSpoilers(content string) string {
+	var stripped strings.Builder
+	depth := 0
+	for content != "" {
+		start := strings.Index(content, spoilerMarker)
+		end := strings.Index(content, endSpoilerMarker)
+		switch {
+		case start == -1 && end == -1:
+			if depth == 0 {
+				stripped.WriteString(content)
+			}
+			content = ""
+		case end == -1 || (start != -1 && start < end):
+			if depth == 0 {
+				stripped.WriteString(content[:start])
+			}
+			depth++
+			content = content[start+len(spoilerMarker):]
+		default:
+			if depth == 0 {
+				stripped.WriteString(content[:end])
+			}
+			depth = max(0, depth-1)
+			stripped.WriteString(" ")
+			content = content[end+len(endSpoilerMarker):]
+		}
+	}
+	return stripped.String()
+}
+
+// match returns a snippet of the puzzle's text if every term appears somewhere
+// in the first visibleSections sections of it.
+func (e searchEntry) match(terms []string, visibleSections int) (string, bool) {
+	sections := e.lower[:min(visibleSections, len(e.lower))]
+	for _, term := range terms {
+		found := false
+		for _, section := range sections {
+			if strings.Contains(section, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	// Prefer showing a match from the content rather than the title
+	for i := len(sections) - 1; i >= 0; i-- {
+		if index := strings.Index(sections[i], terms[0]); index != -1 {
+			return snippet(e.sections[i], sections[i], index, len(terms[0])), true
+		}
+	}
+	return "", true
+}
+
+// snippet extracts the text around a match. The match position is found in
+// the lowercased text, which is only used for the extract itself if
+// lowercasing changed the length of the original.
+func snippet(original string, lower string, index int, length int) string {
+	text := original
+	if len(original) != len(lower) {
+		text = lower
+	}
+	start := max(0, index-snippetContext)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := min(len(text), index+length+snippetContext)
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	extract := text[start:end]
+	if start > 0 {
+		extract = "…" + extract
+	}
+	if end < len(text) {
+		extract += "…"
+	}
+	return extract
+}
+
+func serveSearch(config *Config, store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		if !config.Features.Enabled("search") || !puzzlesOpen(config) {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		progress := loadProgress(config, request)
+		page := SearchView{
+			Team:  newTeamView(config, progress, request),
+			Query: strings.TrimSpace(request.FormValue("q")),
+		}
+		terms := strings.Fields(strings.ToLower(page.Query))
+		if len(terms) > 0 {
+			for _, entry := range foundPuzzles.search {
+				// Only search the parts of multi-stage puzzles that the team
+				// would be able to see.
+				visible := 2
+				if len(entry.puzzle.Parts) > 0 {
+					visible += min(progress.PartsSolved(entry.puzzle.ID)+1, len(entry.puzzle.Parts))
+				}
+				if extract, ok := entry.match(terms, visible); ok {
+					page.Results = append(page.Results, SearchResult{Puzzle: newPuzzleLink(entry.puzzle, progress), Snippet: extract})
+				}
+			}
+		}
+		renderTemplate(writer, config, "search.html", page)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"markup", "<p>Some <b>bold</b> text</p>", "Some bold text"},
+		{"spoiler", `before {{spoiler}}hidden{{endspoiler}} after`, "before after"},
+		{"nested span", `before {{spoiler}}<span>a</span> hidden tail{{endspoiler}} after`, "before after"},
+		{"nested spoiler", `a {{spoiler}}b {{spoiler}}c{{endspoiler}} d{{endspoiler}} e`, "a e"},
+		{"hintbox", "text {{hintbox}}", "text"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			puzzle := &Puzzle{Dir: "test"}
+			meta := &Puzzlemeta{Hints: []string{"a hint"}}
+			content, err := expandShortcodes(puzzle, meta, test.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plainText(content); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
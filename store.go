@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxVersions is how many sets of puzzles are kept to roll back to.
+const maxVersions = 20
+
+// PuzzleVersion is a set of puzzles that has been served, so it can be
+// rolled back to.
+type PuzzleVersion struct {
+	Number int
+	Time   time.Time
+	// Description says where the version came from, e.g. a reload.
+	Description string
+	// Diff is what changed from the version before, or nil for the first.
+	Diff    *PuzzleDiff
+	puzzles *Puzzles
+}
+
+// PuzzleStore holds the puzzles currently being served. A set of Puzzles is
+// never changed once it's loaded: reloading builds a new one and swaps it in,
+// so each request can use the snapshot it started with without locking, and
+// never sees a half-finished reload.
+//
+// Everything that does change while the hunt is running (feature flags, the
+// journal, the activity feed and so on) has its own lock.
+type PuzzleStore struct {
+	puzzles atomic.Pointer[Puzzles]
+	// reloading guards the rest of the fields, and stops two reloads
+	// happening at once.
+	reloading sync.Mutex
+	// pending are reloaded puzzles with changed answers, waiting for an
+	// organiser to confirm them.
+	pending     *Puzzles
+	pendingDiff *PuzzleDiff
+	// versions are the most recent sets of puzzles served, oldest first. The
+	// last one is the current one.
+	versions []*PuzzleVersion
+}
+
+func newPuzzleStore(foundPuzzles *Puzzles) *PuzzleStore {
+	store := &PuzzleStore{}
+	store.puzzles.Store(foundPuzzles)
+	store.versions = []*PuzzleVersion{{
+		Number:      1,
+		Time:        time.Now(),
+		Description: "loaded at startup",
+		puzzles:     foundPuzzles,
+	}}
+	return store
+}
+
+// Load returns the current puzzles. Callers should load them once per
+// request, and use the same snapshot throughout.
+func (s *PuzzleStore) Load() *Puzzles {
+	return s.puzzles.Load()
+}
+
+// Reload reads the puzzles folder again, and starts serving the new puzzles
+// if they're all valid. If they're not the current ones are kept. If any
+// answers have changed, or puzzles have been removed, the whole reload is
+// held back until it's confirmed, so a mistake can't suddenly mark teams'
+// guesses wrong mid-hunt. Each reload replaces any that was held back.
+func (s *PuzzleStore) Reload() (*PuzzleDiff, error) {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	foundPuzzles, err := getPuzzles()
+	if err != nil {
+		return nil, err
+	}
+	diff := diffPuzzles(s.Load(), foundPuzzles)
+	for _, line := range diff.Summary() {
+		log.Printf("Reload: %s", line)
+	}
+	if s.pending != nil {
+		log.Printf("Reload replaces the one waiting to be confirmed from %s", s.pendingDiff.Time.Format(time.TimeOnly))
+	}
+	s.pending, s.pendingDiff = nil, nil
+	if diff.NeedsConfirmation() {
+		log.Printf("Reload changes answers, so it needs confirming from the admin page")
+		s.pending, s.pendingDiff = foundPuzzles, diff
+		return diff, nil
+	}
+	s.apply(foundPuzzles, diff, "reloaded")
+	return diff, nil
+}
+
+// apply starts serving a new set of puzzles, and adds it to the versions.
+// The reloading mutex must be held.
+func (s *PuzzleStore) apply(foundPuzzles *Puzzles, diff *PuzzleDiff, description string) {
+	s.puzzles.Store(foundPuzzles)
+	s.versions = append(s.versions, &PuzzleVersion{
+		Number:      s.versions[len(s.versions)-1].Number + 1,
+		Time:        diff.Time,
+		Description: description,
+		Diff:        diff,
+		puzzles:     foundPuzzles,
+	})
+	if len(s.versions) > maxVersions {
+		s.versions = slices.Delete(s.versions, 0, len(s.versions)-maxVersions)
+	}
+	log.Printf("Now serving %d puzzles (%s)", len(foundPuzzles.Puzzles), description)
+}
+
+// Confirm starts serving the puzzles from a reload that was held back.
+func (s *PuzzleStore) Confirm() error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	if s.pending == nil {
+		return errors.New("no reload waiting to be confirmed")
+	}
+	s.apply(s.pending, s.pendingDiff, "reloaded and confirmed")
+	s.pending, s.pendingDiff = nil, nil
+	return nil
+}
+
+// Rollback starts serving the puzzles from an earlier version again. This
+// becomes a new version itself, so it can be undone in the same way. Only
+// what was read when the puzzles were loaded is rolled back; other files are
+// always served as they are now, so it's refused if any of them have changed
+// since, as their checksums and integrity hashes would be wrong. Any reload
+// waiting to be confirmed is discarded, as its changes were worked out from
+// the puzzles being rolled back from.
+func (s *PuzzleStore) Rollback(number int) error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	index := slices.IndexFunc(s.versions, func(version *PuzzleVersion) bool {
+		return version.Number == number
+	})
+	if index == -1 {
+		return fmt.Errorf("no version %d", number)
+	}
+	if index == len(s.versions)-1 {
+		return fmt.Errorf("version %d is already being served", number)
+	}
+	if changed := changedFiles(s.versions[index].puzzles); len(changed) > 0 {
+		return fmt.Errorf("files have changed since version %d was loaded: %s", number, strings.Join(changed, ", "))
+	}
+	diff := diffPuzzles(s.Load(), s.versions[index].puzzles)
+	for _, line := range diff.Summary() {
+		log.Printf("Rollback: %s", line)
+	}
+	if s.pending != nil {
+		log.Printf("Discarded reload waiting to be confirmed, as the puzzles have been rolled back")
+	}
+	s.pending, s.pendingDiff = nil, nil
+	s.apply(s.versions[index].puzzles, diff, fmt.Sprintf("rolled back to version %d", number))
+	return nil
+}
+
+// Discard throws away a reload that was held back.
+func (s *PuzzleStore) Discard() {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	if s.pending != nil {
+		log.Printf("Discarded reload")
+	}
+	s.pending, s.pendingDiff = nil, nil
+}
+
+// PendingDiff returns the changes from the reload waiting to be confirmed,
+// if there is one.
+func (s *PuzzleStore) PendingDiff() *PuzzleDiff {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	return s.pendingDiff
+}
+
+// Versions returns the versions that can be rolled back to, newest first.
+// The first is the one currently being served.
+func (s *PuzzleStore) Versions() []PuzzleVersion {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	var versions []PuzzleVersion
+	for _, version := range slices.Backward(s.versions) {
+		versions = append(versions, *version)
+	}
+	return versions
+}
+
+func handleReload(store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := store.Reload(); err != nil {
+			log.Printf("Unable to reload puzzles: %v", err)
+			http.Error(writer, "Unable to reload puzzles: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
+
+// handlePendingReload confirms or discards a reload that was held back.
+func handlePendingReload(store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		switch request.FormValue("action") {
+		case "confirm":
+			if err := store.Confirm(); err != nil {
+				writer.WriteHeader(http.StatusConflict)
+				return
+			}
+		case "discard":
+			store.Discard()
+		default:
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
+
+func handleRollback(store *PuzzleStore) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		number, err := strconv.Atoi(request.FormValue("version"))
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := store.Rollback(number); err != nil {
+			http.Error(writer, "Unable to roll back: "+err.Error(), http.StatusConflict)
+			return
+		}
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// setAnswer changes the answer of one of a test hunt's puzzles on disk, ready
+// for the next reload.
+func setAnswer(tb testing.TB, i int, answer string) {
+	tb.Helper()
+	page := fmt.Sprintf("<!--\ntitle: Puzzle %d\nslug: puzzle-%d\naliases: [old-%d]\nanswers: [%s]\n-->\n<p>Puzzle number %d.</p>\n", i, i, i, answer, i)
+	if err := writeTestFile(filepath.Join("puzzles", fmt.Sprintf("dir-%d", i), "index.html"), page); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestReloadNeedsConfirmation(t *testing.T) {
+	hunt := newTestHunt(t, 3)
+	setAnswer(t, 1, "changed")
+	diff, err := hunt.store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.NeedsConfirmation() || hunt.store.PendingDiff() == nil {
+		t.Fatal("changing an answer didn't need confirming")
+	}
+	if response := hunt.guess("puzzle-1", "answer-1"); response.Code != http.StatusOK {
+		t.Errorf("old answer before confirming: got %d", response.Code)
+	}
+	if err := hunt.store.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+	if hunt.store.PendingDiff() != nil {
+		t.Error("reload still pending after confirming it")
+	}
+	if response := hunt.guess("puzzle-1", "changed"); response.Code != http.StatusOK {
+		t.Errorf("new answer after confirming: got %d", response.Code)
+	}
+	if err := hunt.store.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if response := hunt.guess("puzzle-1", "answer-1"); response.Code != http.StatusOK {
+		t.Errorf("old answer after rolling back: got %d", response.Code)
+	}
+	versions := hunt.store.Versions()
+	if len(versions) != 3 || versions[0].Number != 3 || versions[2].Number != 1 {
+		t.Errorf("got versions %v", versions)
+	}
+	if err := hunt.store.Rollback(3); err == nil {
+		t.Error("rolled back to the version already being served")
+	}
+}
+
+// TestReloadConcurrently reloads, confirms and rolls back puzzles while
+// teams are viewing them and guessing, for the race detector to check
+// (go test -race).
+func TestReloadConcurrently(t *testing.T) {
+	const puzzles = 20
+	hunt := newTestHunt(t, puzzles)
+	done := make(chan struct{})
+	var teams sync.WaitGroup
+	for team := range 4 {
+		teams.Add(1)
+		go func() {
+			defer teams.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				n := (team + i) % puzzles
+				for _, response := range []int{
+					hunt.get(fmt.Sprintf("/puzzles/puzzle-%d/", n)).Code,
+					hunt.get(fmt.Sprintf("/puzzles/old-%d/", n)).Code,
+					hunt.get("/").Code,
+				} {
+					if response >= http.StatusInternalServerError {
+						t.Errorf("got %d while reloading", response)
+					}
+				}
+				hunt.guess(fmt.Sprintf("puzzle-%d", n), fmt.Sprintf("answer-%d", n))
+				_ = hunt.store.Load().Lookup(fmt.Sprintf("puzzle-%d", n))
+			}
+		}()
+	}
+	for i := range 30 {
+		switch i % 3 {
+		case 0:
+			setAnswer(t, i%puzzles, fmt.Sprintf("reloaded-%d", i))
+			if _, err := hunt.store.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			if err := hunt.store.Confirm(); err != nil {
+				t.Fatal(err)
+			}
+		case 1:
+			if _, err := hunt.store.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			_ = hunt.store.PendingDiff()
+		case 2:
+			versions := hunt.store.Versions()
+			if err := hunt.store.Rollback(versions[len(versions)-1].Number); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(done)
+	teams.Wait()
+}
+
+func TestRollbackChangedFiles(t *testing.T) {
+	hunt := newTestHunt(t, 3)
+	setAnswer(t, 1, "changed")
+	if _, err := hunt.store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hunt.store.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+	setAnswer(t, 2, "pending")
+	if _, err := hunt.store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	grid := filepath.Join("puzzles", "dir-1", "grid.txt")
+	if err := writeTestFile(grid, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hunt.store.Rollback(1); err == nil {
+		t.Error("rolled back with a file that's changed since")
+	}
+	if err := writeTestFile(grid, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hunt.store.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if hunt.store.PendingDiff() != nil {
+		t.Error("reload still pending after rolling back")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUploadSize is the largest file teams can submit as an answer.
+const maxUploadSize = 20 << 20
+
+// maxPendingSubmissions is how many submissions for one puzzle can be
+// waiting to be reviewed at once. Each team only has one at a time, so this
+// stops a client that keeps throwing its cookie away from filling the disk.
+const maxPendingSubmissions = 100
+
+var errTooManySubmissions = errors.New("too many submissions waiting to be reviewed")
+
+// Submission is a file a team has uploaded as their answer to a puzzle with
+// the "upload" type, to be checked by an organiser.
+type Submission struct {
+	ID     string `json:"id"`
+	Puzzle string `json:"puzzle"`
+	// Team is the ID of the team that uploaded it.
+	Team        string    `json:"team,omitempty"`
+	Time        time.Time `json:"time"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	// Status is "pending" until an organiser reviews the submission, and
+	// then "approved" or "rejected".
+	Status string `json:"status"`
+}
+
+// Submissions keeps track of uploaded answers. Each is stored in the uploads
+// folder as the file itself, named after the submission's ID, and a JSON
+// file with its details.
+type Submissions struct {
+	dir   string
+	mutex sync.RWMutex
+	byID  map[string]*Submission
+}
+
+// loadSubmissions reads the details of every submission in the uploads folder.
+func loadSubmissions(config *Config) *Submissions {
+	submissions := &Submissions{dir: config.Uploads, byID: make(map[string]*Submission)}
+	entries, err := os.ReadDir(config.Uploads)
+	if errors.Is(err, os.ErrNotExist) {
+		return submissions
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		detailBytes, err := os.ReadFile(filepath.Join(config.Uploads, e.Name()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		submission := &Submission{}
+		if err := json.Unmarshal(detailBytes, submission); err != nil {
+			log.Fatalf("Unable to read submission %s: %v", e.Name(), err)
+		}
+		submissions.byID[submission.ID] = submission
+	}
+	return submissions
+}
+
+// Add stores a newly uploaded file, in place of any submission from the same
+// team for the puzzle that's still waiting to be reviewed.
+func (s *Submissions) Add(puzzleID string, team string, file io.Reader, fileName string, contentType string) (*Submission, error) {
+	if s.pendingFor(puzzleID, team) >= maxPendingSubmissions {
+		return nil, errTooManySubmissions
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	submission := &Submission{
+		ID:          hex.EncodeToString(id),
+		Puzzle:      puzzleID,
+		Team:        team,
+		Time:        time.Now(),
+		FileName:    fileName,
+		ContentType: contentType,
+		Status:      "pending",
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	output, err := os.OpenFile(filepath.Join(s.dir, submission.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(output, file)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.save(submission)
+	}
+	if err != nil {
+		_ = os.Remove(filepath.Join(s.dir, submission.ID))
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, previous := range s.byID {
+		if previous.Puzzle == puzzleID && previous.Team == team && previous.Status == "pending" {
+			s.remove(id)
+		}
+	}
+	s.byID[submission.ID] = submission
+	return submission, nil
+}
+
+// pendingFor returns how many submissions for a puzzle from teams other than
+// the given one are waiting to be reviewed.
+func (s *Submissions) pendingFor(puzzleID string, team string) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	count := 0
+	for _, submission := range s.byID {
+		if submission.Puzzle == puzzleID && submission.Team != team && submission.Status == "pending" {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Submissions) save(submission *Submission) error {
+	detailBytes, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, submission.ID+".json"), detailBytes, 0600)
+}
+
+// Get returns the submission with the given ID, or nil if there isn't one.
+func (s *Submissions) Get(id string) *Submission {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if submission, ok := s.byID[id]; ok {
+		copied := *submission
+		return &copied
+	}
+	return nil
+}
+
+// Pending returns the submissions waiting to be reviewed, oldest first.
+func (s *Submissions) Pending() []Submission {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var pending []Submission
+	for _, submission := range s.byID {
+		if submission.Status == "pending" {
+			pending = append(pending, *submission)
+		}
+	}
+	slices.SortFunc(pending, func(a, b Submission) int {
+		return a.Time.Compare(b.Time)
+	})
+	return pending
+}
+
+// Review marks a submission as "approved" or "rejected".
+func (s *Submissions) Review(id string, status string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	submission, ok := s.byID[id]
+	if !ok {
+		return errors.New("no such submission")
+	}
+	submission.Status = status
+	return s.save(submission)
+}
+
+// remove deletes a submission that hasn't been reviewed yet, when the team
+// replaces it with another. The mutex must be held.
+func (s *Submissions) remove(id string) {
+	delete(s.byID, id)
+	_ = os.Remove(filepath.Join(s.dir, id))
+	_ = os.Remove(filepath.Join(s.dir, id+".json"))
+}
+
+// checkSubmission returns the team's latest submission for a puzzle, if they
+// have one, and marks the puzzle as solved if it's been approved. It returns
+// whether the team's progress changed.
+func checkSubmission(config *Config, submissions *Submissions, hub *EventHub, progress *Progress, puzzle *Puzzle) (*Submission, bool) {
+	submission := submissions.Get(progress.Submissions[puzzle.ID])
+	if submission == nil || submission.Status != "approved" || progress.IsSolved(puzzle.ID) {
+		return submission, false
+	}
+	solve(config, hub, progress, puzzle)
+	return submission, true
+}
+
+// handleSubmission accepts a file uploaded as the answer to a puzzle. The
+// team's cookie remembers the submission, so the puzzle can be marked as
+// solved for them once it's approved.
+func handleSubmission(config *Config, store *PuzzleStore, submissions *Submissions, hub *EventHub) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		foundPuzzles := store.Load()
+		if !config.Features.Enabled("guessing") || !puzzlesOpen(config) {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if config.Progress == "" {
+			// There'd be no way to mark the puzzle as solved for the team
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, maxUploadSize)
+		found := foundPuzzles.Lookup(request.FormValue("puzzle"))
+		if found == nil || found.Metadata.Type != "upload" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if found.Metadata.Archived != "" {
+			writer.WriteHeader(http.StatusGone)
+			return
+		}
+		file, header, err := request.FormFile("file")
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		progress := loadProgress(config, request)
+		if !progress.IsSolved(found.ID) {
+			submission, err := submissions.Add(found.ID, progress.Team, file, header.Filename, header.Header.Get("Content-Type"))
+			if errors.Is(err, errTooManySubmissions) {
+				http.Error(writer, "Too many answers are waiting to be checked for this puzzle, please try again later", http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				writer.WriteHeader(http.StatusInternalServerError)
+				fmt.Println("Unable to store submission")
+				fmt.Println(err)
+				return
+			}
+			progress.Submit(found.ID, submission.ID)
+			saveProgress(config, writer, request, progress)
+			hub.Publish(Event{Event: "guess", Team: progress.Team, Puzzle: found.ID, Guess: header.Filename, Result: "submitted"})
+		}
+		http.Redirect(writer, request, "/puzzles/"+url.PathEscape(found.ID)+"/", http.StatusSeeOther)
+	}
+}
+
+// serveSubmission lets organisers download a submitted file. It's always sent
+// as an attachment, so nothing a team uploads can run on the admin pages.
+func serveSubmission(submissions *Submissions) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		submission := submissions.Get(request.PathValue("id"))
+		if submission == nil {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/octet-stream")
+		writer.Header().Set("X-Content-Type-Options", "nosniff")
+		writer.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(filepath.Base(submission.FileName), `"`, "")+`"`)
+		http.ServeFile(writer, request, filepath.Join(submissions.dir, submission.ID))
+	}
+}
+
+func handleReview(submissions *Submissions) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		status := map[string]string{"approve": "approved", "reject": "rejected"}[request.FormValue("action")]
+		if status == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := submissions.Review(request.PathValue("id"), status); err != nil {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}
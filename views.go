@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// The types in this file are the data the templates in the layout folder are
+// rendered with. They're kept separate from the structs puzzles are loaded
+// into so layouts don't break when those change, and so nothing is exposed
+// to a template that shouldn't be sent to teams, such as answers.
+
+// HeadView is passed to the "head" partial in head.html.
+type HeadView struct {
+	// Scripts and Styles are a puzzle's own files to include, with their
+	// integrity hashes. They're empty on every other page.
+	Scripts []Asset
+	Styles  []Asset
+}
+
+// TeamView is the team looking at a page.
+type TeamView struct {
+	// Tracked is whether the team's progress is tracked by the server. If it
+	// isn't, Solved is always empty.
+	Tracked bool
+	// Solved are the IDs of the puzzles the team has solved.
+	Solved []string
+	// Accessible is whether the team has turned on accessible versions of
+	// files.
+	Accessible bool
+}
+
+// PuzzleLink is a puzzle listed on another page.
+type PuzzleLink struct {
+	ID    string
+	Title string
+	// URL is the puzzle's page, relative to the root of the site.
+	URL  string
+	Tags []string
+	// Solved is whether the team has solved the puzzle.
+	Solved bool
+}
+
+// IndexView is the data index.html is rendered with, for the index page and
+// each tag's page.
+type IndexView struct {
+	Head HeadView
+	Team TeamView
+	// Content is the HTML of puzzles/index.html, or of before.html or
+	// after.html outside the hunt.
+	Content string
+	// Puzzles are the puzzles to list, filtered to those with Tag if it's
+	// set. Tags are all the tags that can be filtered on. Both are empty
+	// before the hunt starts.
+	Puzzles []PuzzleLink
+	Tags    []string
+	Tag     string
+}
+
+// PuzzleView is the data puzzle.html is rendered with.
+type PuzzleView struct {
+	Head  HeadView
+	Team  TeamView
+	ID    string
+	Title string
+	// Type is "numeric" or "upload" for puzzles with those types, otherwise
+	// empty.
+	Type string
+	// Content is the puzzle's HTML, with any conditional blocks that don't
+	// apply to the team removed.
+	Content string
+	// Path is the page's path, for forms that return to it.
+	Path   string
+	Solved bool
+	// Parts are the HTML of the parts of a multi-stage puzzle the team can
+	// see, and CurrentPart is the number of the last of them.
+	Parts       []string
+	CurrentPart int
+	// SubAnswers is how many sub-answers the puzzle has, and FoundSubAnswers
+	// are the ones the team has found (only if their progress is tracked).
+	SubAnswers      int
+	FoundSubAnswers []string
+	// Submission is the team's latest submission, for upload puzzles.
+	Submission *Submission
+}
+
+// ArchivedView is the data archived.html is rendered with, for puzzles that
+// have been withdrawn.
+type ArchivedView struct {
+	Head    HeadView
+	Team    TeamView
+	Title   string
+	Message string
+	// Solved is whether the team solved the puzzle before it was withdrawn.
+	Solved bool
+}
+
+// SearchView is the data search.html is rendered with.
+type SearchView struct {
+	Head    HeadView
+	Team    TeamView
+	Query   string
+	Results []SearchResult
+}
+
+// ActivityView is the data activity.html is rendered with.
+type ActivityView struct {
+	Head  HeadView
+	Items []ActivityItem
+	// Size is how many items the feed keeps, so the page can trim older
+	// ones as new ones arrive.
+	Size int
+	// Embed is set for ?embed=1, to show just the feed.
+	Embed bool
+}
+
+func newTeamView(config *Config, progress *Progress, request *http.Request) TeamView {
+	return TeamView{
+		Tracked:    config.Progress != "",
+		Solved:     slices.Clone(progress.Solved),
+		Accessible: accessibleVersions(request),
+	}
+}
+
+func newPuzzleLink(puzzle *Puzzle, progress *Progress) PuzzleLink {
+	return PuzzleLink{
+		ID:     puzzle.ID,
+		Title:  puzzle.Metadata.Title,
+		URL:    "/puzzles/" + url.PathEscape(puzzle.ID) + "/",
+		Tags:   puzzle.Metadata.Tags,
+		Solved: progress.IsSolved(puzzle.ID),
+	}
+}
+
+// newPuzzleView returns the view of a puzzle for a team, which should
+// already have had forTeam applied to it.
+func newPuzzleView(puzzle *Puzzle, progress *Progress, team TeamView, path string) PuzzleView {
+	view := PuzzleView{
+		Head:       HeadView{Scripts: puzzle.Scripts, Styles: puzzle.Styles},
+		Team:       team,
+		ID:         puzzle.ID,
+		Title:      puzzle.Metadata.Title,
+		Type:       puzzle.Metadata.Type,
+		Content:    puzzle.Content,
+		Path:       path,
+		Solved:     progress.IsSolved(puzzle.ID),
+		SubAnswers: len(puzzle.Metadata.SubAnswers),
+	}
+	if len(puzzle.Parts) > 0 {
+		view.CurrentPart = min(progress.PartsSolved(puzzle.ID)+1, len(puzzle.Parts))
+		for _, part := range puzzle.Parts[:view.CurrentPart] {
+			view.Parts = append(view.Parts, part.Content)
+		}
+	}
+	for _, index := range progress.SubAnswers[puzzle.ID] {
+		if index < len(puzzle.Metadata.SubAnswers) {
+			view.FoundSubAnswers = append(view.FoundSubAnswers, puzzle.Metadata.SubAnswers[index][0])
+		}
+	}
+	return view
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WebhookConfig describes an endpoint that events are sent to.
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// Secret is used to sign each request body with HMAC-SHA256. The
+	// signature is sent in the X-Poozles-Signature header.
+	Secret string `yaml:"secret"`
+	// Events lists the kinds of event to send (any of "guess", "solve",
+	// "unlock", "announcement" and "response"). If it's empty then every
+	// event is sent.
+	Events []string `yaml:"events"`
+	// MaxAttempts is how many times to try sending each event. Defaults to 5.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	// webhookQueueSize is how many events can be waiting to be sent to each
+	// webhook before new ones are dropped.
+	webhookQueueSize = 1000
+	// defaultWebhookAttempts is how many times delivering an event is tried
+	// before giving up, if the webhook doesn't say.
+	defaultWebhookAttempts = 5
+	maxWebhookBackoff      = 5 * time.Minute
+)
+
+// webhookDelivery is an event waiting to be sent to a webhook. Its ID stays
+// the same when it's retried, so receivers can ignore duplicates.
+type webhookDelivery struct {
+	id        string
+	eventType string
+	body      []byte
+}
+
+// Webhooks sends events to each configured webhook in the background. Each
+// webhook has its own queue, so a slow or broken endpoint doesn't hold up
+// the others, and events are sent to it in order. Failed deliveries are
+// retried with exponential backoff. Queues are only kept in memory, so
+// anything not sent by the time the server shuts down is lost.
+type Webhooks struct {
+	mutex  sync.Mutex
+	closed bool
+	queues []webhookQueue
+}
+
+type webhookQueue struct {
+	webhook    WebhookConfig
+	deliveries chan webhookDelivery
+	// done is closed once every delivery has been sent or given up on, after
+	// deliveries is closed.
+	done chan struct{}
+}
+
+func newWebhooks(config *Config) *Webhooks {
+	webhooks := &Webhooks{}
+	for _, webhook := range config.Webhooks {
+		queue := webhookQueue{
+			webhook:    webhook,
+			deliveries: make(chan webhookDelivery, webhookQueueSize),
+			done:       make(chan struct{}),
+		}
+		go queue.run()
+		webhooks.queues = append(webhooks.queues, queue)
+	}
+	return webhooks
+}
+
+// Send queues an event for every webhook that wants it.
+func (w *Webhooks) Send(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Unable to encode %s event: %v", event.Event, err)
+		return
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Unable to create delivery ID: %v", err)
+		return
+	}
+	delivery := webhookDelivery{id: hex.EncodeToString(id), eventType: event.Event, body: body}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return
+	}
+	for _, queue := range w.queues {
+		if len(queue.webhook.Events) > 0 && !slices.Contains(queue.webhook.Events, event.Event) {
+			continue
+		}
+		select {
+		case queue.deliveries <- delivery:
+		default:
+			log.Printf("Dropping %s event for %s, too many events are waiting to be sent", event.Event, queue.webhook.URL)
+		}
+	}
+}
+
+// Close stops accepting events, and waits for the ones already queued to be
+// sent until ctx is done.
+func (w *Webhooks) Close(ctx context.Context) {
+	w.mutex.Lock()
+	w.closed = true
+	for _, queue := range w.queues {
+		close(queue.deliveries)
+	}
+	w.mutex.Unlock()
+	for _, queue := range w.queues {
+		select {
+		case <-queue.done:
+		case <-ctx.Done():
+			log.Printf("Shutting down without sending %d queued events to %s", len(queue.deliveries)+1, queue.webhook.URL)
+		}
+	}
+}
+
+func (q webhookQueue) run() {
+	defer close(q.done)
+	for delivery := range q.deliveries {
+		backoff := time.Second
+		for attempt := 1; ; attempt++ {
+			err := deliverWebhook(q.webhook, delivery)
+			if err == nil {
+				break
+			}
+			if attempt >= q.webhook.MaxAttempts {
+				log.Printf("Giving up sending %s event to %s after %d attempts: %v", delivery.eventType, q.webhook.URL, attempt, err)
+				break
+			}
+			log.Printf("Unable to send %s event to %s, retrying in %s: %v", delivery.eventType, q.webhook.URL, backoff, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxWebhookBackoff)
+		}
+	}
+}
+
+func deliverWebhook(webhook WebhookConfig, delivery webhookDelivery) error {
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Poozles-Event", delivery.eventType)
+	request.Header.Set("X-Poozles-Delivery", delivery.id)
+	request.Header.Set("X-Poozles-Signature", "sha256="+webhookSignature(webhook.Secret, delivery.body))
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response: %s", response.Status)
+	}
+	return nil
+}
+
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
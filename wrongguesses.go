@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxClusterExamples is how many different spellings of a wrong guess are
+// kept to show organisers.
+const maxClusterExamples = 5
+
+// GuessCluster is a group of wrong guesses for a puzzle that are the same
+// once case, spacing and punctuation are ignored.
+type GuessCluster struct {
+	Key   string
+	Count int
+	// Guesses are some of the guesses in the cluster, as they were typed.
+	Guesses []string
+	// Response is the message set from the admin page for guesses in the
+	// cluster, if there is one.
+	Response string
+}
+
+type guessTarget struct {
+	Puzzle string
+	Part   int
+}
+
+// WrongGuesses groups the wrong guesses made for each puzzle (or part), so
+// organisers can see what teams are getting stuck on and respond to the
+// common ones.
+type WrongGuesses struct {
+	mutex     sync.RWMutex
+	clusters  map[guessTarget]map[string]*GuessCluster
+	responses map[guessTarget]map[string]string
+}
+
+func newWrongGuesses() *WrongGuesses {
+	return &WrongGuesses{
+		clusters:  make(map[guessTarget]map[string]*GuessCluster),
+		responses: make(map[guessTarget]map[string]string),
+	}
+}
+
+// guessKey normalises a wrong guess so that guesses that only differ in
+// case, spacing or punctuation end up in the same cluster. It's also how
+// guesses are matched to the responses in a puzzle's frontmatter, so those
+// and the ones set from the admin page treat guesses the same way.
+func guessKey(guess string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, guess)
+}
+
+// Record adds incorrect guesses to their cluster, and keeps track of the
+// responses set from the admin page.
+func (w *WrongGuesses) Record(event Event) {
+	target := guessTarget{Puzzle: event.Puzzle, Part: event.Part}
+	key := guessKey(event.Guess)
+	if key == "" {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	switch {
+	case event.Event == "guess" && event.Result == "incorrect":
+		if w.clusters[target] == nil {
+			w.clusters[target] = make(map[string]*GuessCluster)
+		}
+		cluster := w.clusters[target][key]
+		if cluster == nil {
+			cluster = &GuessCluster{Key: key}
+			w.clusters[target][key] = cluster
+		}
+		cluster.Count++
+		if len(cluster.Guesses) < maxClusterExamples && !slices.Contains(cluster.Guesses, event.Guess) {
+			cluster.Guesses = append(cluster.Guesses, event.Guess)
+		}
+	case event.Event == "response" && event.Message == "":
+		delete(w.responses[target], key)
+	case event.Event == "response":
+		if w.responses[target] == nil {
+			w.responses[target] = make(map[string]string)
+		}
+		w.responses[target][key] = event.Message
+	}
+}
+
+// Response returns the message set from the admin page for a guess, or an
+// empty string if there isn't one.
+func (w *WrongGuesses) Response(puzzle string, part int, guess string) string {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.responses[guessTarget{Puzzle: puzzle, Part: part}][guessKey(guess)]
+}
+
+// Top returns the most common clusters of wrong guesses for a puzzle (or
+// part), most common first.
+func (w *WrongGuesses) Top(puzzle string, part int, count int) []GuessCluster {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	target := guessTarget{Puzzle: puzzle, Part: part}
+	var clusters []GuessCluster
+	for _, cluster := range w.clusters[target] {
+		copied := *cluster
+		copied.Guesses = slices.Clone(cluster.Guesses)
+		copied.Response = w.responses[target][cluster.Key]
+		clusters = append(clusters, copied)
+	}
+	slices.SortFunc(clusters, func(a, b GuessCluster) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return clusters[:min(count, len(clusters))]
+}
+
+// WrongGuessSummary lists the most common wrong guesses for a puzzle, or one
+// part of it, for the admin page.
+type WrongGuessSummary struct {
+	Puzzle   string
+	Title    string
+	Part     int
+	Clusters []GuessCluster
+}
+
+// summarise returns the most common wrong guesses for every puzzle and part
+// that's had any.
+func (w *WrongGuesses) summarise(foundPuzzles *Puzzles, count int) []WrongGuessSummary {
+	var summaries []WrongGuessSummary
+	for _, puzzle := range foundPuzzles.Puzzles {
+		parts := []int{0}
+		for i := range puzzle.Parts {
+			parts = append(parts, i+1)
+		}
+		for _, part := range parts {
+			if clusters := w.Top(puzzle.ID, part, count); len(clusters) > 0 {
+				summaries = append(summaries, WrongGuessSummary{
+					Puzzle:   puzzle.ID,
+					Title:    puzzle.Metadata.Title,
+					Part:     part,
+					Clusters: clusters,
+				})
+			}
+		}
+	}
+	return summaries
+}
+
+// handleResponse sets the message shown to teams for a cluster of wrong
+// guesses, or removes it if the message is blank. It's published as an event
+// so the journal keeps it over restarts.
+func handleResponse(hub *EventHub) func(writer http.ResponseWriter, request *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		part, err := strconv.Atoi(request.FormValue("part"))
+		if err != nil || request.FormValue("puzzle") == "" || request.FormValue("guess") == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hub.Publish(Event{
+			Event:   "response",
+			Puzzle:  request.FormValue("puzzle"),
+			Part:    part,
+			Guess:   request.FormValue("guess"),
+			Message: strings.TrimSpace(request.FormValue("message")),
+		})
+		http.Redirect(writer, request, "/admin/", http.StatusSeeOther)
+	}
+}